@@ -0,0 +1,203 @@
+package meetup
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// activeSpeaker keeps one audio and one video subscription of a client on the
+// dominant speaker. The tracks are switched behind the negotiated senders, so the
+// client follows the speaker without a renegotiation.
+type activeSpeaker struct {
+	mu     sync.Mutex
+	client *Client
+	tracks map[webrtc.RTPCodecType]string
+}
+
+func newActiveSpeaker(client *Client) *activeSpeaker {
+	return &activeSpeaker{
+		mu:     sync.Mutex{},
+		client: client,
+		tracks: make(map[webrtc.RTPCodecType]string),
+	}
+}
+
+// FollowActiveSpeaker subscribes the client to the audio and the video of the
+// dominant speaker, or the latest speaker when nobody dominates yet, and keeps
+// following the speaker. The client receives a single audio and a single video
+// track whose source changes with the speaker.
+func (c *Client) FollowActiveSpeaker() error {
+	if c.State() == ClientStateEnded {
+		return ErrClientStopped
+	}
+
+	c.muTracks.Lock()
+	if c.activeSpeaker == nil {
+		c.activeSpeaker = newActiveSpeaker(c)
+	}
+
+	follower := c.activeSpeaker
+	c.muTracks.Unlock()
+
+	if follower.subscribe() {
+		c.renegotiate()
+	}
+
+	return nil
+}
+
+func (c *Client) onDominantSpeakerChanged(speakerID string) {
+	c.muTracks.Lock()
+	follower := c.activeSpeaker
+	c.muTracks.Unlock()
+
+	if follower != nil {
+		follower.onDominantSpeakerChanged(speakerID)
+	}
+}
+
+func (a *activeSpeaker) subscribe() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	added := false
+
+	for _, kind := range []webrtc.RTPCodecType{webrtc.RTPCodecTypeAudio, webrtc.RTPCodecTypeVideo} {
+		if _, ok := a.tracks[kind]; ok {
+			continue
+		}
+
+		for _, publisher := range a.candidates("") {
+			track := speakerTrack(publisher, kind, "")
+			if track == nil {
+				continue
+			}
+
+			if _, err := a.client.addTrack(track); err != nil {
+				a.client.log.Errorf("activespeaker: error subscribing to track %s: %s", track.ID(), err.Error())
+				continue
+			}
+
+			a.tracks[kind] = track.ID()
+			added = true
+
+			break
+		}
+	}
+
+	return added
+}
+
+func (a *activeSpeaker) onDominantSpeakerChanged(speakerID string) {
+	if speakerID == "" || speakerID == a.client.ID() {
+		return
+	}
+
+	speaker, err := a.client.sfu.GetClient(speakerID)
+	if err != nil {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for kind, id := range a.tracks {
+		a.switchTo(kind, id, speaker)
+	}
+}
+
+// onTrackEnded moves the subscription of an ended track to the next speaker and
+// reports whether the track was followed. Without another publisher the
+// subscription stays silent until someone speaks.
+func (a *activeSpeaker) onTrackEnded(track ITrack) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	id, ok := a.tracks[track.Kind()]
+	if !ok || id != track.ID() {
+		return false
+	}
+
+	for _, publisher := range a.candidates(track.ClientID()) {
+		if a.switchTo(track.Kind(), id, publisher) {
+			break
+		}
+	}
+
+	return true
+}
+
+func (a *activeSpeaker) switchTo(kind webrtc.RTPCodecType, id string, publisher *Client) bool {
+	ct, err := a.client.getClientTrack(id)
+	if err != nil {
+		return false
+	}
+
+	if ct.Track().ClientID() == publisher.ID() {
+		return true
+	}
+
+	track := speakerTrack(publisher, kind, ct.MimeType())
+	if track == nil {
+		return false
+	}
+
+	if _, err := a.client.switchClientTrack(id, track); err != nil {
+		a.client.log.Debugf("activespeaker: error switching %s to track %s: %s", id, track.ID(), err.Error())
+		return false
+	}
+
+	a.tracks[kind] = track.ID()
+
+	return true
+}
+
+// candidates returns the other publishers of the room, the dominant speaker first
+// and then the latest speakers.
+func (a *activeSpeaker) candidates(excludeID string) []*Client {
+	sfu := a.client.sfu
+	dominantID := sfu.DominantSpeakerID()
+
+	publishers := make([]*Client, 0)
+	for id, client := range sfu.GetClients() {
+		if id != a.client.ID() && id != excludeID {
+			publishers = append(publishers, client)
+		}
+	}
+
+	sort.SliceStable(publishers, func(i, j int) bool {
+		idA, idB := publishers[i].ID(), publishers[j].ID()
+		if (idA == dominantID) != (idB == dominantID) {
+			return idA == dominantID
+		}
+
+		lastA, lastB := sfu.lastN.lastSpokeAt(idA), sfu.lastN.lastSpokeAt(idB)
+		if !lastA.Equal(lastB) {
+			return lastA.After(lastB)
+		}
+
+		return idA < idB
+	})
+
+	return publishers
+}
+
+// speakerTrack returns a live camera or microphone track of the publisher, an
+// empty mime type matches any codec.
+func speakerTrack(publisher *Client, kind webrtc.RTPCodecType, mimeType string) ITrack {
+	for _, track := range publisher.PublishedTracks() {
+		if track.Kind() != kind || track.IsScreen() || track.Context().Err() != nil {
+			continue
+		}
+
+		if mimeType != "" && track.MimeType() != mimeType {
+			continue
+		}
+
+		return track
+	}
+
+	return nil
+}
@@ -0,0 +1,148 @@
+package meetup
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gautam24s/meetup/pkg/interceptors/voiceactivedetector"
+	"github.com/pion/interceptor"
+)
+
+const (
+	// audio level is in -dBov, 127 is silence
+	audioLevelSilence = 127
+	audioLevelTimeout = 500 * time.Millisecond
+	// weight of a new packet in the smoothed loudness
+	audioLevelSmoothing = 0.2
+)
+
+type audioLevelState struct {
+	loudness      float64
+	lastPacket    time.Time
+	selectedUntil time.Time
+}
+
+// audioTopN forwards only the loudest N audio tracks of the room. A selected
+// track stays forwarded for the hold duration after it drops out of the top N so
+// the end of a sentence isn't clipped. It is disabled while the room has no more
+// than minClients clients.
+type audioTopN struct {
+	mu         sync.RWMutex
+	sfu        *SFU
+	n          int
+	hold       time.Duration
+	minClients int
+	tracks     map[string]*audioLevelState
+}
+
+func newAudioTopN(sfu *SFU, n int, hold time.Duration, minClients int) *audioTopN {
+	return &audioTopN{
+		mu:         sync.RWMutex{},
+		sfu:        sfu,
+		n:          n,
+		hold:       hold,
+		minClients: minClients,
+		tracks:     make(map[string]*audioLevelState),
+	}
+}
+
+func (a *audioTopN) isEnabled() bool {
+	return a.n > 0 && a.sfu.clients.Length() > a.minClients
+}
+
+// forward records the audio level of the packet and reports whether the packet
+// should be forwarded to the subscribers.
+func (a *audioTopN) forward(trackID string, attrs interceptor.Attributes) bool {
+	if a.n <= 0 {
+		return true
+	}
+
+	level, ok := attrs.Get(voiceactivedetector.ATTRIBUTE_KEY).(uint8)
+	if !ok {
+		// without audio levels the track can't be ranked
+		return true
+	}
+
+	now := time.Now()
+	loudness := float64(audioLevelSilence - min(level, audioLevelSilence))
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	state, ok := a.tracks[trackID]
+	if !ok {
+		state = &audioLevelState{loudness: loudness}
+		a.tracks[trackID] = state
+	}
+
+	state.loudness += (loudness - state.loudness) * audioLevelSmoothing
+	state.lastPacket = now
+
+	if !a.isEnabled() {
+		return true
+	}
+
+	return now.Before(state.selectedUntil)
+}
+
+func (a *audioTopN) removeTrack(trackID string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	delete(a.tracks, trackID)
+}
+
+func (a *audioTopN) loop() {
+	if a.n <= 0 {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(a.sfu.context)
+	defer cancel()
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.selectTracks()
+		}
+	}
+}
+
+func (a *audioTopN) selectTracks() {
+	now := time.Now()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	ids := make([]string, 0, len(a.tracks))
+	for id, state := range a.tracks {
+		// DTX streams stop sending packets in silence
+		if now.Sub(state.lastPacket) > audioLevelTimeout {
+			state.loudness = 0
+		}
+
+		ids = append(ids, id)
+	}
+
+	sort.Slice(ids, func(i, j int) bool {
+		if a.tracks[ids[i]].loudness != a.tracks[ids[j]].loudness {
+			return a.tracks[ids[i]].loudness > a.tracks[ids[j]].loudness
+		}
+
+		return ids[i] < ids[j]
+	})
+
+	for i := 0; i < len(ids) && i < a.n; i++ {
+		state := a.tracks[ids[i]]
+		if state.loudness > 0 {
+			state.selectedUntil = now.Add(a.hold)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package meetup
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gautam24s/meetup/pkg/interceptors/voiceactivedetector"
+	"github.com/pion/interceptor"
+)
+
+func audioLevelAttributes(level uint8) interceptor.Attributes {
+	return interceptor.Attributes{voiceactivedetector.ATTRIBUTE_KEY: level}
+}
+
+func newTestAudioTopN(n int, hold time.Duration, minClients int, clients ...string) *audioTopN {
+	s := newTestSFU()
+	for _, id := range clients {
+		newTestRoomClient(s, id, ClientOptions{})
+	}
+
+	return newAudioTopN(s, n, hold, minClients)
+}
+
+func TestAudioTopNDisabled(t *testing.T) {
+	testCases := []struct {
+		name  string
+		topN  *audioTopN
+		attrs interceptor.Attributes
+	}{
+		{"no top N", newTestAudioTopN(0, time.Second, 0, "alice", "bob"), audioLevelAttributes(audioLevelSilence)},
+		{"small room", newTestAudioTopN(1, time.Second, 2, "alice", "bob"), audioLevelAttributes(audioLevelSilence)},
+		{"no audio level", newTestAudioTopN(1, time.Second, 0, "alice", "bob"), interceptor.Attributes{}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if !tc.topN.forward("track", tc.attrs) {
+				t.Error("the packet should be forwarded")
+			}
+		})
+	}
+}
+
+func TestAudioTopNSelectsLoudest(t *testing.T) {
+	a := newTestAudioTopN(2, time.Hour, 2, "alice", "bob", "carol")
+
+	levels := map[string]uint8{"loud": 10, "mid": 40, "quiet": 90}
+
+	send := func() map[string]bool {
+		forwarded := make(map[string]bool)
+		for id, level := range levels {
+			forwarded[id] = a.forward(id, audioLevelAttributes(level))
+		}
+
+		return forwarded
+	}
+
+	// nothing is selected before the first ranking
+	if forwarded := send(); forwarded["loud"] {
+		t.Error("a track shouldn't be forwarded before it is ranked")
+	}
+
+	a.selectTracks()
+
+	forwarded := send()
+	if !forwarded["loud"] || !forwarded["mid"] || forwarded["quiet"] {
+		t.Errorf("forwarded = %v, want the two loudest", forwarded)
+	}
+
+	// the quiet track gets louder, the dropped one is held
+	levels["quiet"] = 0
+	for i := 0; i < 50; i++ {
+		send()
+	}
+
+	a.selectTracks()
+
+	forwarded = send()
+	if !forwarded["quiet"] || !forwarded["loud"] || !forwarded["mid"] {
+		t.Errorf("forwarded = %v, want the new speaker and the held ones", forwarded)
+	}
+}
+
+func TestAudioTopNSilentTrack(t *testing.T) {
+	a := newTestAudioTopN(1, time.Hour, 0, "alice", "bob")
+
+	a.forward("alice", audioLevelAttributes(10))
+	a.forward("bob", audioLevelAttributes(90))
+
+	// a DTX track that stopped sending drops to silence and isn't selected
+	a.tracks["alice"].lastPacket = time.Now().Add(-2 * audioLevelTimeout)
+	a.selectTracks()
+
+	if a.tracks["alice"].loudness != 0 || !a.tracks["alice"].selectedUntil.IsZero() {
+		t.Errorf("silent track = %+v, want no loudness and not selected", *a.tracks["alice"])
+	}
+
+	if a.tracks["bob"].selectedUntil.IsZero() {
+		t.Error("the track still sending should be selected")
+	}
+
+	a.removeTrack("alice")
+
+	if _, ok := a.tracks["alice"]; ok {
+		t.Error("a removed track should be forgotten")
+	}
+}
@@ -0,0 +1,226 @@
+package meetup
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	messageTypeClientKicked = "client_kicked"
+
+	banReason = "banned"
+)
+
+// BanStore keeps the bans of the rooms so they survive the room being closed and
+// created again. A ban until the zero time never expires.
+type BanStore interface {
+	LoadBans(roomID string) (map[string]time.Time, error)
+	SaveBans(roomID string, bans map[string]time.Time) error
+}
+
+type fileBanStore struct {
+	mu  sync.Mutex
+	dir string
+}
+
+// NewFileBanStore stores the bans of every room as a JSON file in dir.
+func NewFileBanStore(dir string) (BanStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &fileBanStore{
+		mu:  sync.Mutex{},
+		dir: dir,
+	}, nil
+}
+
+func (s *fileBanStore) path(roomID string) string {
+	return filepath.Join(s.dir, url.PathEscape(roomID)+".bans.json")
+}
+
+func (s *fileBanStore) LoadBans(roomID string) (map[string]time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bans := make(map[string]time.Time)
+
+	data, err := os.ReadFile(s.path(roomID))
+	if errors.Is(err, fs.ErrNotExist) {
+		return bans, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &bans); err != nil {
+		return nil, ErrDecodingData
+	}
+
+	return bans, nil
+}
+
+func (s *fileBanStore) SaveBans(roomID string, bans map[string]time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := json.Marshal(bans)
+	if err != nil {
+		return ErrEncodingData
+	}
+
+	// write and rename so a crash never leaves a truncated ban list
+	tmp := s.path(roomID) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, s.path(roomID))
+}
+
+type ClientKickedMessage struct {
+	ClientID string `json:"client_id"`
+	Reason   string `json:"reason"`
+}
+
+// KickClient stops a client with the reason and tells the others, the client can
+// join again unless it is banned. The kicked client is told first and stopped once
+// the message is sent or after a short timeout.
+func (r *Room) KickClient(clientID, reason string) error {
+	client, err := r.sfu.GetClient(clientID)
+	if err != nil {
+		return err
+	}
+
+	client.sendLastInternalMessage(ClientKickedMessage{
+		ClientID: clientID,
+		Reason:   reason,
+	})
+
+	if err := client.StopWithReason(reason); err != nil && err != ErrClientStopped {
+		return err
+	}
+
+	r.sfu.broadcastInternalMessage(ClientKickedMessage{
+		ClientID: clientID,
+		Reason:   reason,
+	})
+
+	r.onEvent(EventTypeClientKicked, map[string]any{
+		"client_id": clientID,
+		"reason":    reason,
+	})
+
+	return nil
+}
+
+// Ban kicks the client with the identity and fails its joins with
+// ErrClientBanned for the duration, a duration of 0 bans it for good. The ban is
+// stored before the kick, a ban that fails to be stored is undone.
+func (r *Room) Ban(identity string, duration time.Duration) error {
+	until := time.Time{}
+	if duration > 0 {
+		until = time.Now().Add(duration)
+	}
+
+	r.mu.Lock()
+	previous, wasBanned := r.bans[identity]
+	r.bans[identity] = until
+	bans := r.copyBans()
+	r.mu.Unlock()
+
+	if err := r.saveBans(bans); err != nil {
+		r.mu.Lock()
+		if wasBanned {
+			r.bans[identity] = previous
+		} else {
+			delete(r.bans, identity)
+		}
+		r.mu.Unlock()
+
+		return err
+	}
+
+	r.onEvent(EventTypeClientBanned, map[string]any{
+		"client_id": identity,
+		"until":     until,
+	})
+
+	if _, err := r.sfu.GetClient(identity); err == nil {
+		return r.KickClient(identity, banReason)
+	}
+
+	return nil
+}
+
+func (r *Room) Unban(identity string) error {
+	r.mu.Lock()
+	delete(r.bans, identity)
+	bans := r.copyBans()
+	r.mu.Unlock()
+
+	return r.saveBans(bans)
+}
+
+func (r *Room) IsBanned(identity string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	until, ok := r.bans[identity]
+
+	return ok && (until.IsZero() || time.Now().Before(until))
+}
+
+// Bans returns the banned identities with the time their ban expires.
+func (r *Room) Bans() map[string]time.Time {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.copyBans()
+}
+
+// copyBans drops the expired bans, the caller holds the lock.
+func (r *Room) copyBans() map[string]time.Time {
+	now := time.Now()
+	bans := make(map[string]time.Time, len(r.bans))
+
+	for identity, until := range r.bans {
+		if until.IsZero() || now.Before(until) {
+			bans[identity] = until
+		}
+	}
+
+	return bans
+}
+
+func (r *Room) loadBans() {
+	if r.options.BanStore == nil {
+		return
+	}
+
+	bans, err := r.options.BanStore.LoadBans(r.id)
+	if err != nil {
+		r.sfu.log.Errorf("room: error loading bans of room %s: %s", r.id, err.Error())
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for identity, until := range bans {
+		r.bans[identity] = until
+	}
+}
+
+func (r *Room) saveBans(bans map[string]time.Time) error {
+	if r.options.BanStore == nil {
+		return nil
+	}
+
+	return r.options.BanStore.SaveBans(r.id, bans)
+}
@@ -0,0 +1,143 @@
+package meetup
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type testBanStore struct {
+	err error
+	// whether the banned client was still in the room when the bans were saved
+	savedBeforeKick bool
+	room            *Room
+	saved           map[string]time.Time
+}
+
+func (s *testBanStore) LoadBans(string) (map[string]time.Time, error) {
+	return map[string]time.Time{}, nil
+}
+
+func (s *testBanStore) SaveBans(_ string, bans map[string]time.Time) error {
+	if s.err != nil {
+		return s.err
+	}
+
+	_, err := s.room.GetClient("alice")
+	s.savedBeforeKick = err == nil
+	s.saved = bans
+
+	return nil
+}
+
+func newTestBanRoom(t *testing.T, store *testBanStore) (*Room, *Client) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	opts := DefaultRoomOptions()
+	opts.BanStore = store
+
+	room, err := NewManager(ctx, "test", DefaultOptions()).NewRoom("room", "room", RoomKindMeeting, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store.room = room
+
+	client, err := room.AddClient("alice", "alice", DefaultClientOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return room, client
+}
+
+func TestBanStoresBeforeKick(t *testing.T) {
+	store := &testBanStore{}
+	room, client := newTestBanRoom(t, store)
+
+	if err := room.Ban("alice", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if !store.savedBeforeKick {
+		t.Error("the ban should be stored before the client is kicked")
+	}
+
+	if until, ok := store.saved["alice"]; !ok || !until.IsZero() {
+		t.Errorf("stored bans = %v, want alice banned for good", store.saved)
+	}
+
+	if client.State() != ClientStateEnded || client.StopReason() != banReason {
+		t.Errorf("client state %d with reason %q, want ended with %q", client.State(), client.StopReason(), banReason)
+	}
+
+	// the kicked client was told before it stopped
+	kicked := false
+
+	for _, payload := range client.pendingInternalMessages {
+		msg, err := DecodeInternalMessage(payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if m, ok := msg.(*ClientKickedMessage); ok && m.ClientID == "alice" && m.Reason == banReason {
+			kicked = true
+		}
+	}
+
+	if !kicked {
+		t.Error("the client should be sent the kick")
+	}
+
+	if _, err := room.AddClient("alice", "alice", DefaultClientOptions()); !errors.Is(err, ErrClientBanned) {
+		t.Errorf("join of a banned client = %v, want %v", err, ErrClientBanned)
+	}
+}
+
+func TestBanNotStored(t *testing.T) {
+	store := &testBanStore{err: errors.New("disk full")}
+	room, client := newTestBanRoom(t, store)
+
+	if err := room.Ban("alice", time.Hour); !errors.Is(err, store.err) {
+		t.Fatalf("Ban = %v, want %v", err, store.err)
+	}
+
+	if room.IsBanned("alice") {
+		t.Error("a ban that wasn't stored should be undone")
+	}
+
+	if client.State() == ClientStateEnded {
+		t.Error("a client whose ban wasn't stored shouldn't be kicked")
+	}
+}
+
+func TestFileBanStore(t *testing.T) {
+	store, err := NewFileBanStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	until := time.Now().Add(time.Hour).Truncate(time.Second)
+	bans := map[string]time.Time{"alice": {}, "bob": until}
+
+	if err := store.SaveBans("room/1", bans); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := store.LoadBans("room/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(loaded) != 2 || !loaded["alice"].IsZero() || !loaded["bob"].Equal(until) {
+		t.Errorf("loaded bans = %v, want %v", loaded, bans)
+	}
+
+	if loaded, err := store.LoadBans("other"); err != nil || len(loaded) != 0 {
+		t.Errorf("bans of a room without a file = %v, %v, want none", loaded, err)
+	}
+}
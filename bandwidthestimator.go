@@ -0,0 +1,156 @@
+package meetup
+
+import (
+	"sync"
+
+	"github.com/gautam24s/meetup/pkg/interceptors/remb"
+	"github.com/pion/interceptor"
+	"github.com/pion/interceptor/pkg/cc"
+	"github.com/pion/interceptor/pkg/gcc"
+	"github.com/pion/webrtc/v4"
+)
+
+const (
+	EstimatorTypeGCC    = "gcc"
+	EstimatorTypeREMB   = "remb"
+	EstimatorTypeStatic = "static"
+)
+
+// BandwidthEstimator estimates the bandwidth available to send media to a client.
+type BandwidthEstimator interface {
+	Type() string
+	// Register adds the interceptors and RTCP feedback the estimator depends on
+	// before the peer connection is created.
+	Register(m *webrtc.MediaEngine, i *interceptor.Registry) error
+	// GetTargetBitrate returns the estimated bandwidth in bits per second.
+	GetTargetBitrate() uint32
+}
+
+type NewBandwidthEstimatorFunc func(initialBitrate uint32) BandwidthEstimator
+
+type gccEstimator struct {
+	mu             sync.RWMutex
+	initialBitrate uint32
+	estimator      cc.BandwidthEstimator
+}
+
+func NewGCCEstimator(initialBitrate uint32) BandwidthEstimator {
+	return &gccEstimator{
+		mu:             sync.RWMutex{},
+		initialBitrate: initialBitrate,
+	}
+}
+
+func (e *gccEstimator) Type() string {
+	return EstimatorTypeGCC
+}
+
+func (e *gccEstimator) Register(m *webrtc.MediaEngine, i *interceptor.Registry) error {
+	congestionController, err := cc.NewInterceptor(func() (cc.BandwidthEstimator, error) {
+		return gcc.NewSendSideBWE(
+			gcc.SendSideBWEInitialBitrate(int(e.initialBitrate)),
+			gcc.SendSideBWEPacer(gcc.NewNoOpPacer()),
+		)
+	})
+	if err != nil {
+		return err
+	}
+
+	congestionController.OnNewPeerConnection(func(id string, estimator cc.BandwidthEstimator) {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+
+		e.estimator = estimator
+	})
+
+	i.Add(congestionController)
+
+	return webrtc.ConfigureTWCCHeaderExtensionSender(m, i)
+}
+
+func (e *gccEstimator) GetTargetBitrate() uint32 {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if e.estimator == nil {
+		return e.initialBitrate
+	}
+
+	return uint32(e.estimator.GetTargetBitrate())
+}
+
+type rembEstimator struct {
+	mu             sync.RWMutex
+	initialBitrate uint32
+	interceptor    *remb.Interceptor
+}
+
+func NewREMBEstimator(initialBitrate uint32) BandwidthEstimator {
+	return &rembEstimator{
+		mu:             sync.RWMutex{},
+		initialBitrate: initialBitrate,
+	}
+}
+
+func (e *rembEstimator) Type() string {
+	return EstimatorTypeREMB
+}
+
+func (e *rembEstimator) Register(m *webrtc.MediaEngine, i *interceptor.Registry) error {
+	rembFactory := remb.NewInterceptor()
+	rembFactory.OnNew(func(i *remb.Interceptor) {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+
+		e.interceptor = i
+	})
+
+	i.Add(rembFactory)
+
+	m.RegisterFeedback(webrtc.RTCPFeedback{Type: webrtc.TypeRTCPFBGoogREMB}, webrtc.RTPCodecTypeVideo)
+
+	return nil
+}
+
+func (e *rembEstimator) GetTargetBitrate() uint32 {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if e.interceptor == nil {
+		return e.initialBitrate
+	}
+
+	bitrate, ok := e.interceptor.Bitrate()
+	if !ok {
+		return e.initialBitrate
+	}
+
+	return bitrate
+}
+
+type staticEstimator struct {
+	bitrate uint32
+}
+
+// NewStaticEstimator returns an estimator that always reports the bitrate, used
+// as ClientOptions.BandwidthEstimator it reports the initial bandwidth. It caps a
+// client when feedback from it can't be trusted:
+//
+//	opts.BandwidthEstimator = func(uint32) BandwidthEstimator {
+//		return NewStaticEstimator(500_000)
+//	}
+func NewStaticEstimator(bitrate uint32) BandwidthEstimator {
+	return &staticEstimator{bitrate: bitrate}
+}
+
+func (e *staticEstimator) Type() string {
+	return EstimatorTypeStatic
+}
+
+func (e *staticEstimator) Register(_ *webrtc.MediaEngine, _ *interceptor.Registry) error {
+	return nil
+}
+
+func (e *staticEstimator) GetTargetBitrate() uint32 {
+	return e.bitrate
+}
@@ -0,0 +1,35 @@
+package meetup
+
+import (
+	"math"
+	"testing"
+)
+
+func TestStaticEstimator(t *testing.T) {
+	estimator := NewStaticEstimator(500_000)
+
+	if estimator.Type() != EstimatorTypeStatic {
+		t.Errorf("type = %s, want %s", estimator.Type(), EstimatorTypeStatic)
+	}
+
+	if bitrate := estimator.GetTargetBitrate(); bitrate != 500_000 {
+		t.Errorf("bitrate = %d, want 500000", bitrate)
+	}
+
+	// the constructors are NewBandwidthEstimatorFunc themselves
+	for _, newEstimator := range []NewBandwidthEstimatorFunc{NewGCCEstimator, NewREMBEstimator, NewStaticEstimator} {
+		estimator := newEstimator(1_000_000)
+
+		if bitrate := estimator.GetTargetBitrate(); bitrate != 1_000_000 {
+			t.Errorf("%s bitrate before feedback = %d, want the initial 1000000", estimator.Type(), bitrate)
+		}
+	}
+}
+
+func TestEstimatedBandwithWithoutEstimator(t *testing.T) {
+	c := &Client{}
+
+	if bw := c.GetEstimatedBandwith(); bw != math.MaxUint32 {
+		t.Errorf("estimated bandwith = %d without an estimator, want unlimited", bw)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/pion/logging"
+	"github.com/pion/webrtc/v4"
 )
 
 type bitrateClaim struct {
@@ -15,6 +16,20 @@ type bitrateClaim struct {
 	simulcase bool
 }
 
+func (c *bitrateClaim) Quality() QualityLevel {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.quality
+}
+
+func (c *bitrateClaim) setQuality(quality QualityLevel) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.quality = quality
+}
+
 type bitrateController struct {
 	client               *Client
 	claims               sync.Map
@@ -51,6 +66,16 @@ func (bc *bitrateController) loopMonitor() {
 
 			totalSendBitrates := bc.totalSentBitrates()
 			bw := bc.client.GetEstimatedBandwith()
+
+			if totalSendBitrates > bw {
+				needAdjustment = true
+			} else if bc.totalClaimedBitrates() < bw {
+				needAdjustment = bc.canIncreaseQuality(bw)
+			}
+
+			if needAdjustment {
+				bc.fitClaimsToBandwith(bw)
+			}
 		}
 	}
 }
@@ -65,6 +90,16 @@ func (bc *bitrateController) totalSentBitrates() uint32 {
 	return total
 }
 
+func (bc *bitrateController) totalClaimedBitrates() uint32 {
+	total := uint32(0)
+
+	for _, claim := range bc.Claims() {
+		total += bc.qualityBitrate(claim.Quality())
+	}
+
+	return total
+}
+
 func (bc *bitrateController) Claims() map[string]*bitrateClaim {
 	claims := make(map[string]*bitrateClaim, 0)
 	bc.claims.Range(func(key, value any) bool {
@@ -74,3 +109,227 @@ func (bc *bitrateController) Claims() map[string]*bitrateClaim {
 
 	return claims
 }
+
+func (bc *bitrateController) GetClaim(id string) *bitrateClaim {
+	if claim, ok := bc.claims.Load(id); ok {
+		return claim.(*bitrateClaim)
+	}
+
+	return nil
+}
+
+func (bc *bitrateController) addClaim(track iClientTrack, quality QualityLevel) *bitrateClaim {
+	claim := &bitrateClaim{
+		mu:        sync.RWMutex{},
+		track:     track,
+		quality:   quality,
+		simulcase: track.IsSimulcast() || track.IsScaleable(),
+	}
+
+	bc.claims.Store(track.ID(), claim)
+
+	return claim
+}
+
+func (bc *bitrateController) removeClaim(id string) {
+	bc.claims.Delete(id)
+}
+
+// onVideoSizeChanged caps the quality of a track to the smallest layer that still
+// covers the size the subscriber renders it at. The cap is kept on the client
+// track, so it still applies when a paused track resumes with a new claim.
+func (bc *bitrateController) onVideoSizeChanged(trackID string, width, height uint32) error {
+	ct, err := bc.client.getClientTrack(trackID)
+	if err != nil {
+		return err
+	}
+
+	if ct.Kind() != webrtc.RTPCodecTypeVideo {
+		return ErrNotVideoTrack
+	}
+
+	maxQuality := bc.qualityForVideoSize(width, height)
+
+	ct.SetMaxQuality(maxQuality)
+
+	if claim := bc.GetClaim(trackID); claim != nil && claim.Quality() > maxQuality {
+		claim.setQuality(maxQuality)
+	}
+
+	return nil
+}
+
+// qualityForVideoSize picks the layer whose size is the closest one at or above
+// the rendered size. Layer sizes that aren't configured are a quarter of the
+// next layer, like the default ones.
+func (bc *bitrateController) qualityForVideoSize(width, height uint32) QualityLevel {
+	configs := bc.client.sfu.bitrateConfigs
+	pixels := uint64(width) * uint64(height)
+
+	highPixels := uint64(configs.VideoHighPixels)
+	if highPixels == 0 {
+		highPixels = uint64(DefaultBitrates().VideoHighPixels)
+	}
+
+	midPixels := uint64(configs.VideoMidPixels)
+	if midPixels == 0 {
+		midPixels = highPixels / 4
+	}
+
+	lowPixels := uint64(configs.VideoLowPixels)
+	if lowPixels == 0 {
+		lowPixels = midPixels / 4
+	}
+
+	switch {
+	case pixels > midPixels:
+		return QualityHigh
+	case pixels > lowPixels:
+		return QualityMid
+	default:
+		return QualityLow
+	}
+}
+
+func (bc *bitrateController) qualityBitrate(quality QualityLevel) uint32 {
+	configs := bc.client.sfu.bitrateConfigs
+
+	switch quality {
+	case QualityAudioRed:
+		return configs.AudioRed
+	case QualityAudio:
+		return configs.Audio
+	case QualityHigh, QualityHighMid, QualityHighLow:
+		return configs.VideoHigh
+	case QualityMid, QualityMidMid, QualityMidLow:
+		return configs.VideoMid
+	case QualityLow, QualityLowMid, QualityLowLow:
+		return configs.VideoLow
+	default:
+		return 0
+	}
+}
+
+func (bc *bitrateController) lowerQuality(quality QualityLevel) QualityLevel {
+	for _, level := range bc.enabledQualityLevels {
+		if level < quality {
+			return level
+		}
+	}
+
+	return QualityNone
+}
+
+func (bc *bitrateController) higherQuality(quality QualityLevel) QualityLevel {
+	for i := len(bc.enabledQualityLevels) - 1; i >= 0; i-- {
+		if bc.enabledQualityLevels[i] > quality {
+			return bc.enabledQualityLevels[i]
+		}
+	}
+
+	return quality
+}
+
+func (bc *bitrateController) canIncreaseQuality(bw uint32) bool {
+	total := bc.totalClaimedBitrates()
+
+	for _, claim := range bc.Claims() {
+		if !claim.simulcase {
+			continue
+		}
+
+		quality := claim.Quality()
+		next := bc.higherQuality(quality)
+
+		if next == quality || next > claim.track.MaxQuality() {
+			continue
+		}
+
+		if total-bc.qualityBitrate(quality)+bc.qualityBitrate(next) <= bw {
+			return true
+		}
+	}
+
+	return false
+}
+
+// fitClaimsToBandwith walks the simulcast claims down one level at a time until the
+// claimed bitrate fits the estimated bandwidth, then spends whatever is left over
+// upgrading claims one level at a time. Audio and non-simulcast claims are fixed.
+func (bc *bitrateController) fitClaimsToBandwith(bw uint32) {
+	claims := bc.Claims()
+
+	previous := make(map[string]QualityLevel, len(claims))
+	for id, claim := range claims {
+		previous[id] = claim.Quality()
+	}
+
+	defer bc.sendQualityChanges(claims, previous)
+
+	for bc.totalClaimedBitrates() > bw {
+		lowered := false
+
+		for _, claim := range claims {
+			if !claim.simulcase || claim.Quality() <= QualityLowLow {
+				continue
+			}
+
+			claim.setQuality(bc.lowerQuality(claim.Quality()))
+			lowered = true
+
+			if bc.totalClaimedBitrates() <= bw {
+				break
+			}
+		}
+
+		if !lowered {
+			break
+		}
+	}
+
+	for {
+		raised := false
+
+		for _, claim := range claims {
+			if !claim.simulcase {
+				continue
+			}
+
+			quality := claim.Quality()
+			next := bc.higherQuality(quality)
+
+			if next == quality || next > claim.track.MaxQuality() {
+				continue
+			}
+
+			if bc.totalClaimedBitrates()-bc.qualityBitrate(quality)+bc.qualityBitrate(next) > bw {
+				continue
+			}
+
+			claim.setQuality(next)
+			raised = true
+		}
+
+		if !raised {
+			break
+		}
+	}
+}
+
+// sendQualityChanges tells the client which tracks the bandwidth moved to
+// another quality.
+func (bc *bitrateController) sendQualityChanges(claims map[string]*bitrateClaim, previous map[string]QualityLevel) {
+	for id, claim := range claims {
+		quality := claim.Quality()
+		if quality == previous[id] {
+			continue
+		}
+
+		if err := bc.client.sendInternalMessage(QualityChangedMessage{
+			TrackID: claim.track.ID(),
+			Quality: quality,
+		}); err != nil {
+			bc.log.Debugf("bitratecontroller: failed to send quality of track %s: %s", claim.track.ID(), err.Error())
+		}
+	}
+}
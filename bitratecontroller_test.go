@@ -0,0 +1,88 @@
+package meetup
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/pion/webrtc/v4"
+)
+
+func newTestBitrateController(configs BitrateConfigs, tracks ...*clientTrack) *bitrateController {
+	c := &Client{
+		sfu:          &SFU{bitrateConfigs: configs},
+		clientTracks: make(map[string]iClientTrack),
+	}
+
+	c.bitrateController = &bitrateController{client: c}
+
+	for _, ct := range tracks {
+		ct.client = c
+		c.clientTracks[ct.ID()] = ct
+	}
+
+	return c.bitrateController
+}
+
+func TestQualityForVideoSize(t *testing.T) {
+	testCases := []struct {
+		name    string
+		configs BitrateConfigs
+		width   uint32
+		height  uint32
+		want    QualityLevel
+	}{
+		{"thumbnail", DefaultBitrates(), 160, 90, QualityLow},
+		{"low layer size", DefaultBitrates(), 180, 90, QualityLow},
+		{"above the low layer", DefaultBitrates(), 320, 180, QualityMid},
+		{"mid layer size", DefaultBitrates(), 360, 180, QualityMid},
+		{"above the mid layer", DefaultBitrates(), 640, 360, QualityHigh},
+		{"product overflows 32 bits", DefaultBitrates(), 1 << 16, 1 << 16, QualityHigh},
+		{"layers from the high layer size", BitrateConfigs{VideoHighPixels: 1280 * 720}, 640, 360, QualityMid},
+		{"lowest layer from the high layer size", BitrateConfigs{VideoHighPixels: 1280 * 720}, 320, 180, QualityLow},
+		{"unconfigured sizes use the default", BitrateConfigs{}, 320, 180, QualityMid},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			bc := newTestBitrateController(tc.configs)
+
+			if got := bc.qualityForVideoSize(tc.width, tc.height); got != tc.want {
+				t.Errorf("qualityForVideoSize(%d, %d) = %d, want %d", tc.width, tc.height, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestVideoSizeOfPausedTrack(t *testing.T) {
+	ct := newTestClientTrack()
+	ct.id = "video"
+	ct.kind = webrtc.RTPCodecTypeVideo
+	ct.track = newTestPublishedTrack("video", webrtc.RTPCodecTypeVideo, TrackTypeMedia)
+	ct.maxQuality.Store(QualityHigh)
+	ct.pausedReasons.Store(pauseReasonSubscriber)
+
+	bc := newTestBitrateController(DefaultBitrates(), ct)
+
+	if err := bc.onVideoSizeChanged("video", 320, 180); err != nil {
+		t.Fatalf("onVideoSizeChanged of a paused track = %v, want nil", err)
+	}
+
+	if ct.MaxQuality() != QualityMid {
+		t.Errorf("max quality = %d, want %d", ct.MaxQuality(), QualityMid)
+	}
+
+	bc.client.resumeClientTrack(ct, pauseReasonSubscriber)
+
+	claim := bc.GetClaim("video")
+	if claim == nil {
+		t.Fatal("the resumed track should have a claim")
+	}
+
+	if claim.Quality() != QualityMid {
+		t.Errorf("claim quality = %d after the resume, want the cap %d", claim.Quality(), QualityMid)
+	}
+
+	if err := bc.onVideoSizeChanged("missing", 320, 180); !errors.Is(err, ErrTrackIsNotExists) {
+		t.Errorf("onVideoSizeChanged of a missing track = %v, want %v", err, ErrTrackIsNotExists)
+	}
+}
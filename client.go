@@ -3,16 +3,18 @@ package meetup
 import (
 	"context"
 	"errors"
+	"math"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/gautam24s/meetup/pkg/interceptors/twccmonitor"
 	"github.com/gautam24s/meetup/pkg/interceptors/voiceactivedetector"
 	"github.com/pion/interceptor"
-	"github.com/pion/interceptor/pkg/cc"
-	"github.com/pion/interceptor/pkg/gcc"
 	"github.com/pion/interceptor/pkg/nack"
+	"github.com/pion/interceptor/pkg/stats"
 	"github.com/pion/logging"
+	"github.com/pion/rtcp"
 	"github.com/pion/webrtc/v4"
 )
 
@@ -43,6 +45,20 @@ const (
 	messageTypeStats      = "stats"
 	messageTypeVADStarted = "vad_started"
 	messageTypeVADEnded   = "vad_ended"
+
+	messageTypeIngressBandwith = "ingress_bandwith"
+	messageTypePauseTrack      = "pause_track"
+	messageTypeResumeTrack     = "resume_track"
+	messageTypeTracksAvailable = "tracks_available"
+	messageTypePinTrack        = "pin_track"
+	messageTypeUnpinTrack      = "unpin_track"
+	messageTypeTrackMuted      = "track_muted"
+	messageTypeMuteTrack       = "mute_track"
+	messageTypeUnmuteTrack     = "unmute_track"
+	messageTypeUnpublished     = "track_unpublished"
+	messageTypeTrackSource     = "track_source"
+
+	internalDataChannelLabel = "internal"
 )
 
 type QualityLevel uint32
@@ -51,21 +67,35 @@ var (
 	ErrNegotiationIsNotRequested = errors.New("client: error negotitation is called before requested")
 	ErrRenegotiationCallback     = errors.New("client: error renegotiation callback is not set")
 	ErrClientStopped             = errors.New("client: error client already stopped")
+	ErrDataChannelNotReady       = errors.New("client: error internal data channel is not ready")
+	ErrIncompatibleTrack         = errors.New("client: error track kind or codec doesn't match the subscription")
 )
 
 type ClientOptions struct {
-	IceTrickle           bool          `json:"ice_trickle"`
-	IdleTimeout          time.Duration `json:"idle_timeout"`
-	Type                 string        `json:"type"`
-	EnableVoiceDetection bool          `json:"enable_voice_detection"`
-	MinPlayoutDelay      uint16        `json:"min_playout_delay"`
-	MaxPlayoutDelay      uint16        `json:"max_playout_delay"`
-	JitterBufferMinWait  time.Duration `json:"jitter_buffer_min_wait"`
-	JitterBufferMaxWait  time.Duration `json:"jitter_buffer_max_wait"`
-	ReorderPackets       bool          `json:"reorder_packets"`
+	IceTrickle           bool                        `json:"ice_trickle"`
+	IdleTimeout          time.Duration               `json:"idle_timeout"`
+	Type                 string                      `json:"type"`
+	EnableVoiceDetection bool                        `json:"enable_voice_detection"`
+	MinPlayoutDelay      uint16                      `json:"min_playout_delay"`
+	MaxPlayoutDelay      uint16                      `json:"max_playout_delay"`
+	JitterBufferMinWait  time.Duration               `json:"jitter_buffer_min_wait"`
+	JitterBufferMaxWait  time.Duration               `json:"jitter_buffer_max_wait"`
+	ReorderPackets       bool                        `json:"reorder_packets"`
+	AutoSubscribe        bool                        `json:"auto_subscribe"`
+	EnableDynacast       bool                        `json:"enable_dynacast"`
+	DynacastDebounce     time.Duration               `json:"dynacast_debounce"`
+	BandwidthEstimator   NewBandwidthEstimatorFunc   `json:"-"`
+	LastN                int                         `json:"last_n"`
+	MuteDetectionTimeout time.Duration               `json:"mute_detection_timeout"`
+	ReceiveOnly          bool                        `json:"receive_only"`
+	StatsInterval        time.Duration               `json:"stats_interval"`
+	Token                string                      `json:"-"`
+	VoiceDetection       *voiceactivedetector.Config `json:"-"`
 	Log                  logging.LeveledLogger
 	settingEngine        webrtc.SettingEngine
 	qualityLevels        []QualityLevel
+	permissions          *Permissions
+	role                 Role
 }
 
 func DefaultClientOptions() ClientOptions {
@@ -79,6 +109,11 @@ func DefaultClientOptions() ClientOptions {
 		JitterBufferMinWait:  20 * time.Millisecond,
 		JitterBufferMaxWait:  150 * time.Millisecond,
 		ReorderPackets:       false,
+		AutoSubscribe:        true,
+		EnableDynacast:       true,
+		DynacastDebounce:     3 * time.Second,
+		BandwidthEstimator:   NewGCCEstimator,
+		MuteDetectionTimeout: 3 * time.Second,
 		Log:                  logging.NewDefaultLoggerFactory().NewLogger("sfu"),
 	}
 }
@@ -86,15 +121,21 @@ func DefaultClientOptions() ClientOptions {
 type Client struct {
 	id                  string
 	name                string
+	sfu                 *SFU
 	bitrateController   *bitrateController
 	context             context.Context
 	cancel              context.CancelFunc
 	canAddCandidate     *atomic.Bool
 	clientTracks        map[string]iClientTrack
+	pinnedTracks        map[string]bool
 	muTracks            sync.Mutex
 	internalDataChannel *webrtc.DataChannel
+	dataChannels        map[string]*webrtc.DataChannel
 
-	estimator             cc.BandwidthEstimator
+	muInternalMessages      sync.Mutex
+	pendingInternalMessages [][]byte
+
+	estimator             BandwidthEstimator
 	initialReceiverCount  atomic.Int32
 	initialSenderCount    atomic.Int32
 	isInRenegotiation     *atomic.Bool
@@ -116,6 +157,7 @@ type Client struct {
 	onVoiceSentDetectedCallbacks      []func(voiceactivedetector.VoiceActivity)
 	onVoiceReceivedDetectedCallbacks  []func(voiceactivedetector.VoiceActivity)
 	onTrackRemovedCallbacks           []func(sourceType string, track *webrtc.TrackLocalStaticRTP)
+	onTracksAvailableCallbacks        []func([]ITrack)
 	onIceCandidate                    func(context.Context, *webrtc.ICECandidate)
 	onRenegotiation                   func(context.Context, webrtc.SessionDescription) (webrtc.SessionDescription, error)
 	onAllowedRemoteRenegotiation      func()
@@ -133,10 +175,21 @@ type Client struct {
 	isDebug                        bool
 	vadInterceptor                 *voiceactivedetector.Interceptor
 	vads                           map[uint32]*voiceactivedetector.VoiceDetector
+	statsGetter                    stats.Getter
+	publishedTracks                *trackList
+	muPublish                      sync.Mutex
+	ingressEstimator               *ingressEstimator
+	lastN                          *atomic.Int32
+	activeSpeaker                  *activeSpeaker
+	permissions                    *atomic.Value
+	role                           *atomic.Value
+	waiting                        atomic.Bool
+	stopReason                     *atomic.Value
+	meta                           *Metadata
 	log                            logging.LeveledLogger
 }
 
-func NewClient(s *SFU, id string, name string, peerConnectionConfig webrtc.Configuration, opts ClientOptions) {
+func NewClient(s *SFU, id string, name string, peerConnectionConfig webrtc.Configuration, opts ClientOptions) *Client {
 	var client *Client
 	var vadInterceptor *voiceactivedetector.Interceptor
 
@@ -157,43 +210,60 @@ func NewClient(s *SFU, id string, name string, peerConnectionConfig webrtc.Confi
 
 	i := &interceptor.Registry{}
 
-	var vads = make(map[uint32]*voiceactivedetector.VoiceDetector)
-
 	if opts.EnableVoiceDetection {
 		opts.Log.Infof("client: voice detection is enabled")
 		vadInterceptorFactory := voiceactivedetector.NewInterceptor(localCtx, opts.Log)
 
 		vadInterceptorFactory.OnNew(func(i *voiceactivedetector.Interceptor) {
 			vadInterceptor = i
-			i.OnNewVAD(func(vad *voiceactivedetector.VoiceDetector) {
-				vads[vad.SSRC()] = vad
-			})
+
+			if opts.VoiceDetection != nil {
+				i.SetConfig(*opts.VoiceDetection)
+			}
 		})
 
 		i.Add(vadInterceptorFactory)
 	}
 
-	estimatorChan := make(chan cc.BandwidthEstimator, 1)
+	newEstimator := opts.BandwidthEstimator
+	if newEstimator == nil {
+		newEstimator = NewGCCEstimator
+	}
 
-	congestionController, err := cc.NewInterceptor(func() (cc.BandwidthEstimator, error) {
-		return gcc.NewSendSideBWE(
-			gcc.SendSideBWEInitialBitrate(int(s.bitrateConfigs.InitialBandwith)),
-			gcc.SendSideBWEPacer(gcc.NewNoOpPacer()),
-		)
-	})
+	estimator := newEstimator(s.bitrateConfigs.InitialBandwith)
+
+	if s.enableBandwithEstimator {
+		if err := estimator.Register(m, i); err != nil {
+			panic(err)
+		}
+
+		opts.Log.Infof("client: bandwidth estimator %s is enabled", estimator.Type())
+	} else if estimator.Type() != EstimatorTypeStatic {
+		// a static estimator needs no feedback from the client so it still applies
+		estimator = nil
+	}
+
+	var statsGetter stats.Getter
+
+	statsInterceptorFactory, err := stats.NewInterceptor()
 	if err != nil {
 		panic(err)
 	}
 
-	congestionController.OnNewPeerConnection(func(id string, estimator cc.BandwidthEstimator) {
-		estimatorChan <- estimator
+	statsInterceptorFactory.OnNewPeerConnection(func(_ string, g stats.Getter) {
+		statsGetter = g
 	})
 
-	i.Add(congestionController)
+	i.Add(statsInterceptorFactory)
 
-	if err = webrtc.ConfigureTWCCHeaderExtensionSender(m, i); err != nil {
-		panic(err)
-	}
+	var twccMonitor *twccmonitor.Interceptor
+
+	twccMonitorFactory := twccmonitor.NewInterceptor()
+	twccMonitorFactory.OnNew(func(i *twccmonitor.Interceptor) {
+		twccMonitor = i
+	})
+
+	i.Add(twccMonitorFactory)
 
 	if err := registerInterceptors(m, i); err != nil {
 		panic(err)
@@ -211,12 +281,82 @@ func NewClient(s *SFU, id string, name string, peerConnectionConfig webrtc.Confi
 
 	quality.Store(QualityHigh)
 
+	var ingressQualityLimitationReason atomic.Value
+	ingressQualityLimitationReason.Store(QualityLimitationReasonNone)
+
 	client = &Client{
-		id:      id,
-		name:    name,
-		context: localCtx,
-		cancel:  cancel,
+		id:                             id,
+		name:                           name,
+		sfu:                            s,
+		context:                        localCtx,
+		cancel:                         cancel,
+		canAddCandidate:                &atomic.Bool{},
+		clientTracks:                   make(map[string]iClientTrack),
+		pinnedTracks:                   make(map[string]bool),
+		dataChannels:                   make(map[string]*webrtc.DataChannel),
+		muTracks:                       sync.Mutex{},
+		estimator:                      estimator,
+		isInRenegotiation:              &atomic.Bool{},
+		isInRemoteNegotiation:          &atomic.Bool{},
+		mu:                             sync.Mutex{},
+		peerConnection:                 newPeerConnection(peerConnection),
+		pendingRemoteRenegotiation:     &atomic.Bool{},
+		state:                          &stateNew,
+		muCallback:                     sync.Mutex{},
+		options:                        opts,
+		negotiationNeeded:              &atomic.Bool{},
+		pendingRemoteCandidates:        make([]webrtc.ICECandidateInit, 0),
+		pendingLocalCandidates:         make([]*webrtc.ICECandidate, 0),
+		quality:                        &quality,
+		receivingBandwith:              &atomic.Uint32{},
+		egressBandwith:                 &atomic.Uint32{},
+		ingressBandwith:                &atomic.Uint32{},
+		ingressQualityLimitationReason: &ingressQualityLimitationReason,
+		vadInterceptor:                 vadInterceptor,
+		vads:                           make(map[uint32]*voiceactivedetector.VoiceDetector),
+		statsGetter:                    statsGetter,
+		publishedTracks:                newTrackList(),
+		muPublish:                      sync.Mutex{},
+		lastN:                          &atomic.Int32{},
+		permissions:                    &atomic.Value{},
+		role:                           &atomic.Value{},
+		stopReason:                     &atomic.Value{},
+		meta:                           NewMetadata(),
+		log:                            opts.Log,
+	}
+
+	qualityLevels := opts.qualityLevels
+	if len(qualityLevels) == 0 {
+		qualityLevels = DefaultQualityLevels()
+	}
+
+	client.lastN.Store(int32(opts.LastN))
+
+	if opts.permissions != nil {
+		client.permissions.Store(*opts.permissions)
+	} else {
+		client.permissions.Store(DefaultPermissions())
+	}
+
+	client.role.Store(opts.role)
+
+	client.meta.OnChange(client.broadcastMetadata)
+
+	client.bitrateController = newbitrateController(client, qualityLevels)
+	client.ingressEstimator = newIngressEstimator(client, twccMonitor)
+
+	peerConnection.OnTrack(client.onTrack)
+	peerConnection.OnDataChannel(client.onDataChannel)
+	peerConnection.OnICECandidate(client.onLocalIceCandidate)
+	peerConnection.OnConnectionStateChange(client.onConnectionStateChanged)
+
+	go client.ingressEstimator.loop()
+
+	if opts.StatsInterval > 0 {
+		go client.statsLoop()
 	}
+
+	return client
 }
 
 func (c *Client) ID() string {
@@ -231,6 +371,918 @@ func (c *Client) Context() context.Context {
 	return c.context
 }
 
+func (c *Client) PeerConnection() *PeerConnection {
+	return c.peerConnection
+}
+
+func (c *Client) State() int {
+	return c.state.Load().(int)
+}
+
+func (c *Client) Negotiate(offer webrtc.SessionDescription) (*webrtc.SessionDescription, error) {
+	if c.State() == ClientStateEnded {
+		return nil, ErrClientStopped
+	}
+
+	c.isInRemoteNegotiation.Store(true)
+	defer func() {
+		c.isInRemoteNegotiation.Store(false)
+
+		if c.negotiationNeeded.Load() {
+			go c.renegotiate()
+		}
+	}()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pc := c.peerConnection.PC()
+
+	if err := pc.SetRemoteDescription(offer); err != nil {
+		return nil, err
+	}
+
+	answer, err := pc.CreateAnswer(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var gatheringComplete <-chan struct{}
+	if !c.options.IceTrickle {
+		gatheringComplete = webrtc.GatheringCompletePromise(pc)
+	}
+
+	if err := pc.SetLocalDescription(answer); err != nil {
+		return nil, err
+	}
+
+	c.canAddCandidate.Store(true)
+	c.processPendingRemoteCandidates()
+
+	if gatheringComplete != nil {
+		<-gatheringComplete
+	}
+
+	return pc.LocalDescription(), nil
+}
+
+func (c *Client) AddICECandidate(candidate webrtc.ICECandidateInit) error {
+	if !c.canAddCandidate.Load() {
+		c.muCallback.Lock()
+		c.pendingRemoteCandidates = append(c.pendingRemoteCandidates, candidate)
+		c.muCallback.Unlock()
+
+		return nil
+	}
+
+	return c.peerConnection.PC().AddICECandidate(candidate)
+}
+
+func (c *Client) processPendingRemoteCandidates() {
+	c.muCallback.Lock()
+	candidates := c.pendingRemoteCandidates
+	c.pendingRemoteCandidates = make([]webrtc.ICECandidateInit, 0)
+	c.muCallback.Unlock()
+
+	for _, candidate := range candidates {
+		if err := c.peerConnection.PC().AddICECandidate(candidate); err != nil {
+			c.log.Errorf("client: error add ice candidate ", err)
+		}
+	}
+}
+
+func (c *Client) OnIceCandidate(callback func(context.Context, *webrtc.ICECandidate)) {
+	c.muCallback.Lock()
+	c.onIceCandidate = callback
+	candidates := c.pendingLocalCandidates
+	c.pendingLocalCandidates = make([]*webrtc.ICECandidate, 0)
+	c.muCallback.Unlock()
+
+	for _, candidate := range candidates {
+		callback(c.context, candidate)
+	}
+}
+
+func (c *Client) onLocalIceCandidate(candidate *webrtc.ICECandidate) {
+	if candidate == nil {
+		return
+	}
+
+	c.muCallback.Lock()
+	callback := c.onIceCandidate
+	if callback == nil {
+		c.pendingLocalCandidates = append(c.pendingLocalCandidates, candidate)
+	}
+	c.muCallback.Unlock()
+
+	if callback != nil {
+		callback(c.context, candidate)
+	}
+}
+
+func (c *Client) OnConnectionStateChanged(callback func(webrtc.PeerConnectionState)) {
+	c.muCallback.Lock()
+	defer c.muCallback.Unlock()
+
+	c.onConnectionStateChangedCallbacks = append(c.onConnectionStateChangedCallbacks, callback)
+}
+
+func (c *Client) onConnectionStateChanged(state webrtc.PeerConnectionState) {
+	c.muCallback.Lock()
+	callbacks := c.onConnectionStateChangedCallbacks
+	c.muCallback.Unlock()
+
+	for _, callback := range callbacks {
+		callback(state)
+	}
+
+	switch state {
+	case webrtc.PeerConnectionStateConnected:
+		if c.state.CompareAndSwap(ClientStateNew, ClientStateActive) {
+			c.onJoined()
+		}
+	case webrtc.PeerConnectionStateClosed, webrtc.PeerConnectionStateFailed:
+		if err := c.Stop(); err != nil && err != ErrClientStopped {
+			c.log.Errorf("client: error stopping client %s: %s", c.ID(), err.Error())
+		}
+	}
+}
+
+func (c *Client) OnJoined(callback func()) {
+	c.muCallback.Lock()
+	defer c.muCallback.Unlock()
+
+	c.onJoinedCallbacks = append(c.onJoinedCallbacks, callback)
+}
+
+func (c *Client) onJoined() {
+	c.muCallback.Lock()
+	callbacks := c.onJoinedCallbacks
+	c.muCallback.Unlock()
+
+	for _, callback := range callbacks {
+		callback()
+	}
+}
+
+func (c *Client) OnLeft(callback func()) {
+	c.muCallback.Lock()
+	defer c.muCallback.Unlock()
+
+	c.onLeftCallbacks = append(c.onLeftCallbacks, callback)
+}
+
+func (c *Client) onLeft() {
+	c.muCallback.Lock()
+	callbacks := c.onLeftCallbacks
+	c.muCallback.Unlock()
+
+	for _, callback := range callbacks {
+		callback()
+	}
+}
+
+// StopWithReason stops the client, the reason is kept for the signaling to tell
+// the client why it was removed.
+func (c *Client) StopWithReason(reason string) error {
+	c.stopReason.Store(reason)
+
+	return c.Stop()
+}
+
+// StopReason returns the reason the client was stopped with, empty when it left
+// by itself.
+func (c *Client) StopReason() string {
+	reason, _ := c.stopReason.Load().(string)
+
+	return reason
+}
+
+func (c *Client) Stop() error {
+	if c.state.Swap(ClientStateEnded) == ClientStateEnded {
+		return ErrClientStopped
+	}
+
+	for _, ct := range c.ClientTracks() {
+		ct.Track().removeClientTrack(c.id)
+		c.bitrateController.removeClaim(ct.ID())
+	}
+
+	err := c.peerConnection.Close()
+
+	c.cancel()
+
+	c.sfu.removeClient(c)
+
+	c.onLeft()
+
+	return err
+}
+
+func (c *Client) onTrack(remoteTrack *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) {
+	c.muPublish.Lock()
+
+	if existing, err := c.publishedTracks.Get(remoteTrack.ID()); err == nil {
+		c.muPublish.Unlock()
+
+		if track, ok := existing.(*Track); ok {
+			track.addRemoteTrack(remoteTrack)
+		}
+
+		return
+	}
+
+	sourceType := c.trackSourceType(remoteTrack.Kind(), remoteTrack.ID(), TrackTypeMedia)
+
+	if c.options.ReceiveOnly || !c.Permissions().canPublish(remoteTrack.Kind(), sourceType) {
+		c.muPublish.Unlock()
+
+		c.log.Warnf("client: %s is not allowed to publish track %s", c.ID(), remoteTrack.ID())
+
+		if err := receiver.Stop(); err != nil {
+			c.log.Errorf("client: error stop receiver ", err)
+		}
+
+		return
+	}
+
+	track := newTrack(c, remoteTrack)
+	track.SetSourceType(sourceType)
+
+	err := c.publishedTracks.Add(track)
+
+	c.muPublish.Unlock()
+
+	if err != nil {
+		c.log.Errorf("client: error add published track ", err)
+		return
+	}
+
+	track.OnEnded(func() {
+		c.publishedTracks.Remove(track.ID())
+	})
+
+	if remoteTrack.Kind() == webrtc.RTPCodecTypeAudio && c.vadInterceptor != nil {
+		c.mapVoiceDetector(track, remoteTrack)
+	}
+
+	c.sfu.onTrackAvailable(track)
+}
+
+func (c *Client) mapVoiceDetector(track *Track, remoteTrack *webrtc.TrackRemote) {
+	ssrc := uint32(remoteTrack.SSRC())
+
+	vad := c.vadInterceptor.MapAudioTrack(ssrc, remoteTrack)
+	if vad == nil {
+		return
+	}
+
+	c.mu.Lock()
+	c.vads[ssrc] = vad
+	c.mu.Unlock()
+
+	vad.OnVoiceDetected(func(activity voiceactivedetector.VoiceActivity) {
+		c.onVoiceReceivedDetected(activity)
+		c.sfu.onVoiceActivity(c, activity)
+
+		for _, ct := range track.ClientTracks() {
+			if !ct.IsPaused() {
+				ct.Client().onVoiceSentDetected(activity)
+			}
+		}
+	})
+
+	track.OnEnded(func() {
+		c.mu.Lock()
+		delete(c.vads, ssrc)
+		c.mu.Unlock()
+	})
+}
+
+// OnVoiceReceivedDetected is called with the voice activity of the audio tracks
+// the client publishes.
+func (c *Client) OnVoiceReceivedDetected(callback func(voiceactivedetector.VoiceActivity)) {
+	c.muCallback.Lock()
+	defer c.muCallback.Unlock()
+
+	c.onVoiceReceivedDetectedCallbacks = append(c.onVoiceReceivedDetectedCallbacks, callback)
+}
+
+func (c *Client) onVoiceReceivedDetected(activity voiceactivedetector.VoiceActivity) {
+	c.muCallback.Lock()
+	callbacks := c.onVoiceReceivedDetectedCallbacks
+	c.muCallback.Unlock()
+
+	for _, callback := range callbacks {
+		callback(activity)
+	}
+}
+
+// OnVoiceSentDetected is called with the voice activity of the audio tracks the
+// client is subscribed to.
+func (c *Client) OnVoiceSentDetected(callback func(voiceactivedetector.VoiceActivity)) {
+	c.muCallback.Lock()
+	defer c.muCallback.Unlock()
+
+	c.onVoiceSentDetectedCallbacks = append(c.onVoiceSentDetectedCallbacks, callback)
+}
+
+func (c *Client) onVoiceSentDetected(activity voiceactivedetector.VoiceActivity) {
+	c.muCallback.Lock()
+	callbacks := c.onVoiceSentDetectedCallbacks
+	c.muCallback.Unlock()
+
+	for _, callback := range callbacks {
+		callback(activity)
+	}
+}
+
+func (c *Client) OnRenegotiation(callback func(context.Context, webrtc.SessionDescription) (webrtc.SessionDescription, error)) {
+	c.muCallback.Lock()
+	defer c.muCallback.Unlock()
+
+	c.onRenegotiation = callback
+}
+
+func (c *Client) renegotiate() {
+	c.negotiationNeeded.Store(true)
+
+	c.muCallback.Lock()
+	callback := c.onRenegotiation
+	c.muCallback.Unlock()
+
+	if callback == nil {
+		c.log.Debugf("client: %s renegotiation is needed but %s", c.ID(), ErrRenegotiationCallback.Error())
+		return
+	}
+
+	// the remote negotiation will renegotiate once it is done
+	if c.State() == ClientStateEnded || c.isInRemoteNegotiation.Load() || c.peerConnection.PC().RemoteDescription() == nil {
+		return
+	}
+
+	if !c.isInRenegotiation.CompareAndSwap(false, true) {
+		return
+	}
+
+	go func() {
+		for c.negotiationNeeded.Swap(false) {
+			if err := c.doRenegotiation(callback); err != nil {
+				c.log.Errorf("client: %s renegotiation failed: %s", c.ID(), err.Error())
+				break
+			}
+		}
+
+		c.isInRenegotiation.Store(false)
+
+		if c.negotiationNeeded.Load() && c.peerConnection.PC().SignalingState() == webrtc.SignalingStateStable {
+			c.renegotiate()
+		}
+	}()
+}
+
+func (c *Client) doRenegotiation(callback func(context.Context, webrtc.SessionDescription) (webrtc.SessionDescription, error)) error {
+	c.mu.Lock()
+
+	pc := c.peerConnection.PC()
+
+	if pc.SignalingState() != webrtc.SignalingStateStable {
+		c.mu.Unlock()
+		c.negotiationNeeded.Store(true)
+
+		return nil
+	}
+
+	offer, err := pc.CreateOffer(nil)
+	if err != nil {
+		c.mu.Unlock()
+		return err
+	}
+
+	if err := pc.SetLocalDescription(offer); err != nil {
+		c.mu.Unlock()
+		return err
+	}
+
+	c.mu.Unlock()
+
+	answer, err := callback(c.context, *pc.LocalDescription())
+	if err != nil {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		_ = pc.SetLocalDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeRollback})
+
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return pc.SetRemoteDescription(answer)
+}
+
+func (c *Client) addTrack(track ITrack) (iClientTrack, error) {
+	if !c.Permissions().CanSubscribe {
+		return nil, ErrPermissionDenied
+	}
+
+	c.muTracks.Lock()
+
+	if _, ok := c.clientTracks[track.ID()]; ok {
+		c.muTracks.Unlock()
+		return nil, ErrTrackExists
+	}
+
+	localTrack, err := webrtc.NewTrackLocalStaticRTP(track.Codec().RTPCodecCapability, track.ID(), track.StreamID())
+	if err != nil {
+		c.muTracks.Unlock()
+		return nil, err
+	}
+
+	sender, err := c.peerConnection.AddTrack(localTrack)
+	if err != nil {
+		c.muTracks.Unlock()
+		return nil, err
+	}
+
+	ct := newClientTrack(c, track, localTrack, sender)
+	c.clientTracks[track.ID()] = ct
+
+	c.muTracks.Unlock()
+
+	go ct.readRTCP()
+
+	c.bitrateController.addClaim(ct, c.initialQuality(track))
+
+	track.addClientTrack(ct)
+
+	if track.isPaused() {
+		c.pauseClientTrack(ct, pauseReasonMuted)
+	}
+
+	track.OnEnded(func() {
+		c.onSubscribedTrackEnded(track)
+	})
+
+	return ct, nil
+}
+
+// switchClientTrack points the subscription of a track at another published
+// track of the same kind and codec. The new track is written to the negotiated
+// sender, so the subscriber sees the same track and no renegotiation is needed.
+func (c *Client) switchClientTrack(id string, track ITrack) (iClientTrack, error) {
+	c.muTracks.Lock()
+
+	old, ok := c.clientTracks[id]
+	if !ok {
+		c.muTracks.Unlock()
+		return nil, ErrTrackIsNotExists
+	}
+
+	if _, ok := c.clientTracks[track.ID()]; ok {
+		c.muTracks.Unlock()
+		return nil, ErrTrackExists
+	}
+
+	if old.Kind() != track.Kind() || old.MimeType() != track.MimeType() {
+		c.muTracks.Unlock()
+		return nil, ErrIncompatibleTrack
+	}
+
+	ct := newClientTrack(c, track, old.Localtrack(), old.Sender())
+	ct.continueFrom(old)
+
+	delete(c.clientTracks, id)
+	delete(c.pinnedTracks, id)
+	c.clientTracks[track.ID()] = ct
+
+	c.muTracks.Unlock()
+
+	quality := c.initialQuality(track)
+	if claim := c.bitrateController.GetClaim(id); claim != nil {
+		quality = claim.Quality()
+	}
+
+	old.Track().removeClientTrack(c.id)
+	c.bitrateController.removeClaim(id)
+	old.end()
+
+	if !ct.IsPaused() {
+		c.bitrateController.addClaim(ct, quality)
+	}
+
+	track.addClientTrack(ct)
+
+	if track.isPaused() {
+		c.pauseClientTrack(ct, pauseReasonMuted)
+	}
+
+	track.OnEnded(func() {
+		c.onSubscribedTrackEnded(track)
+	})
+
+	return ct, nil
+}
+
+func (c *Client) onSubscribedTrackEnded(track ITrack) {
+	c.muTracks.Lock()
+	follower := c.activeSpeaker
+	c.muTracks.Unlock()
+
+	if follower != nil && follower.onTrackEnded(track) {
+		return
+	}
+
+	if err := c.removeClientTrack(track.ID()); err == nil {
+		c.renegotiate()
+	}
+}
+
+func (c *Client) initialQuality(track ITrack) QualityLevel {
+	switch {
+	case track.Kind() == webrtc.RTPCodecTypeAudio && track.MimeType() == "audio/red":
+		return QualityAudioRed
+	case track.Kind() == webrtc.RTPCodecTypeAudio:
+		return QualityAudio
+	case track.IsSimulcast() || track.IsScaleable():
+		return QualityLow
+	default:
+		return QualityHigh
+	}
+}
+
+func (c *Client) removeClientTrack(id string) error {
+	c.muTracks.Lock()
+	ct, ok := c.clientTracks[id]
+	delete(c.clientTracks, id)
+	delete(c.pinnedTracks, id)
+	c.muTracks.Unlock()
+
+	if !ok {
+		return ErrTrackIsNotExists
+	}
+
+	ct.Track().removeClientTrack(c.id)
+	c.bitrateController.removeClaim(id)
+
+	if c.State() != ClientStateEnded {
+		if err := c.peerConnection.RemoveTrack(ct.Sender()); err != nil {
+			c.log.Errorf("client: error remove track ", err)
+		}
+	}
+
+	ct.end()
+
+	return nil
+}
+
+func (c *Client) getClientTrack(id string) (iClientTrack, error) {
+	c.muTracks.Lock()
+	defer c.muTracks.Unlock()
+
+	ct, ok := c.clientTracks[id]
+	if !ok {
+		return nil, ErrTrackIsNotExists
+	}
+
+	return ct, nil
+}
+
+// PauseTrack stops forwarding a subscribed track without renegotiating it away
+// and releases its bitrate claim.
+func (c *Client) PauseTrack(trackID string) error {
+	ct, err := c.getClientTrack(trackID)
+	if err != nil {
+		return err
+	}
+
+	c.pauseClientTrack(ct, pauseReasonSubscriber)
+
+	return nil
+}
+
+func (c *Client) ResumeTrack(trackID string) error {
+	ct, err := c.getClientTrack(trackID)
+	if err != nil {
+		return err
+	}
+
+	c.resumeClientTrack(ct, pauseReasonSubscriber)
+
+	return nil
+}
+
+func (c *Client) pauseClientTrack(ct iClientTrack, reason uint32) {
+	if ct.pause(reason) {
+		c.bitrateController.removeClaim(ct.ID())
+	}
+}
+
+func (c *Client) resumeClientTrack(ct iClientTrack, reason uint32) {
+	if ct.resume(reason) {
+		quality := c.initialQuality(ct.Track())
+		if ct.Kind() == webrtc.RTPCodecTypeVideo {
+			quality = min(quality, ct.MaxQuality())
+		}
+
+		c.bitrateController.addClaim(ct, quality)
+	}
+}
+
+// LastN returns the number of active speakers whose video is forwarded to the
+// client, 0 means every video track is forwarded.
+func (c *Client) LastN() int {
+	n := int(c.lastN.Load())
+
+	switch {
+	case n < 0:
+		return 0
+	case n == 0:
+		return c.sfu.lastN.N()
+	default:
+		return n
+	}
+}
+
+// SetLastN overrides the room last-N for this client, 0 uses the room value and
+// a negative value forwards every video track.
+func (c *Client) SetLastN(n int) {
+	c.lastN.Store(int32(n))
+}
+
+// PinTracks keeps forwarding the video of the tracks' publishers regardless of
+// the last-N selection.
+func (c *Client) PinTracks(trackIDs ...string) error {
+	c.muTracks.Lock()
+	defer c.muTracks.Unlock()
+
+	errs := make([]error, 0)
+
+	for _, id := range trackIDs {
+		if _, ok := c.clientTracks[id]; !ok {
+			errs = append(errs, ErrTrackIsNotExists)
+			continue
+		}
+
+		c.pinnedTracks[id] = true
+	}
+
+	return FlattenErrors(errs)
+}
+
+func (c *Client) UnpinTracks(trackIDs ...string) {
+	c.muTracks.Lock()
+	defer c.muTracks.Unlock()
+
+	for _, id := range trackIDs {
+		delete(c.pinnedTracks, id)
+	}
+}
+
+func (c *Client) IsPinned(trackID string) bool {
+	c.muTracks.Lock()
+	defer c.muTracks.Unlock()
+
+	return c.pinnedTracks[trackID]
+}
+
+type SubscribeRequest struct {
+	ClientID string `json:"client_id"`
+	TrackID  string `json:"track_id"`
+}
+
+// SubscribeTracks subscribes the client to the published tracks of other clients
+// in the room. All the tracks are negotiated with a single offer.
+func (c *Client) SubscribeTracks(requests []SubscribeRequest) error {
+	if c.State() == ClientStateEnded {
+		return ErrClientStopped
+	}
+
+	if !c.Permissions().CanSubscribe {
+		return ErrPermissionDenied
+	}
+
+	errs := make([]error, 0)
+	added := 0
+
+	for _, req := range requests {
+		track, err := c.sfu.getPublishedTrack(req.ClientID, req.TrackID)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		if track.ClientID() == c.ID() {
+			continue
+		}
+
+		if _, err := c.addTrack(track); err != nil {
+			if err != ErrTrackExists {
+				errs = append(errs, err)
+			}
+
+			continue
+		}
+
+		added++
+	}
+
+	if added > 0 {
+		c.renegotiate()
+	}
+
+	return FlattenErrors(errs)
+}
+
+func (c *Client) UnsubscribeTracks(requests []SubscribeRequest) error {
+	errs := make([]error, 0)
+	removed := 0
+
+	for _, req := range requests {
+		ct, err := c.getClientTrack(req.TrackID)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		if ct.Track().ClientID() != req.ClientID {
+			errs = append(errs, ErrTrackIsNotExists)
+			continue
+		}
+
+		if err := c.removeClientTrack(req.TrackID); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		removed++
+	}
+
+	if removed > 0 {
+		c.renegotiate()
+	}
+
+	return FlattenErrors(errs)
+}
+
+// AvailableTracks returns the tracks published by the other clients in the room.
+func (c *Client) AvailableTracks() []ITrack {
+	tracks := make([]ITrack, 0)
+
+	for _, client := range c.sfu.GetClients() {
+		if client.ID() == c.ID() {
+			continue
+		}
+
+		tracks = append(tracks, client.PublishedTracks()...)
+	}
+
+	return tracks
+}
+
+func (c *Client) OnTracksAvailable(callback func([]ITrack)) {
+	c.muCallback.Lock()
+	defer c.muCallback.Unlock()
+
+	c.onTracksAvailableCallbacks = append(c.onTracksAvailableCallbacks, callback)
+}
+
+func (c *Client) onTracksAvailable(tracks []ITrack) {
+	c.muCallback.Lock()
+	callbacks := c.onTracksAvailableCallbacks
+	c.muCallback.Unlock()
+
+	for _, callback := range callbacks {
+		callback(tracks)
+	}
+
+	infos := make([]TrackInfo, 0, len(tracks))
+	for _, track := range tracks {
+		infos = append(infos, NewTrackInfo(track))
+	}
+
+	if err := c.sendInternalMessage(TracksAvailableMessage(infos)); err != nil {
+		c.log.Debugf("client: failed to announce tracks to %s: %s", c.ID(), err.Error())
+	}
+}
+
+func (c *Client) ClientTracks() []iClientTrack {
+	c.muTracks.Lock()
+	defer c.muTracks.Unlock()
+
+	tracks := make([]iClientTrack, 0, len(c.clientTracks))
+	for _, ct := range c.clientTracks {
+		tracks = append(tracks, ct)
+	}
+
+	return tracks
+}
+
+func (c *Client) PublishedTracks() []ITrack {
+	return c.publishedTracks.GetTracks()
+}
+
+func (c *Client) sendPLI(ssrc webrtc.SSRC) {
+	if err := c.peerConnection.PC().WriteRTCP([]rtcp.Packet{
+		&rtcp.PictureLossIndication{MediaSSRC: uint32(ssrc)},
+	}); err != nil {
+		c.log.Errorf("client: error sending PLI ", err)
+	}
+}
+
+func (c *Client) onDataChannel(dc *webrtc.DataChannel) {
+	if dc.Label() != internalDataChannelLabel {
+		c.onClientDataChannel(dc)
+
+		return
+	}
+
+	c.mu.Lock()
+	c.internalDataChannel = dc
+	c.mu.Unlock()
+
+	dc.OnMessage(c.onInternalMessage)
+
+	dc.OnOpen(func() {
+		c.flushInternalMessages()
+		c.sendMetadataSnapshot()
+		c.openDataChannels()
+
+		if c.options.AutoSubscribe {
+			return
+		}
+
+		if tracks := c.AvailableTracks(); len(tracks) > 0 {
+			c.onTracksAvailable(tracks)
+		}
+	})
+}
+
+func (c *Client) onInternalMessage(msg webrtc.DataChannelMessage) {
+	internalMessage, err := DecodeInternalMessage(msg.Data)
+	if err != nil {
+		c.log.Debugf("client: error decoding internal message from %s: %s", c.ID(), err.Error())
+		return
+	}
+
+	switch m := internalMessage.(type) {
+	case *VideoSizeMessage:
+		if err := c.bitrateController.onVideoSizeChanged(m.TrackID, m.Width, m.Height); err != nil {
+			c.log.Debugf("client: video size of track %s ignored: %s", m.TrackID, err.Error())
+		}
+	case *TrackControlMessage:
+		var err error
+
+		switch m.Type {
+		case messageTypePauseTrack:
+			err = c.PauseTrack(m.TrackID)
+		case messageTypeResumeTrack:
+			err = c.ResumeTrack(m.TrackID)
+		case messageTypeMuteTrack, messageTypeUnmuteTrack:
+			err = c.SetTrackMuted(m.TrackID, m.Type == messageTypeMuteTrack)
+		case messageTypePinTrack:
+			err = c.PinTracks(m.TrackID)
+		case messageTypeUnpinTrack:
+			c.UnpinTracks(m.TrackID)
+		}
+
+		if err != nil {
+			c.log.Debugf("client: %s of track %s failed: %s", m.Type, m.TrackID, err.Error())
+		}
+	case *TrackSourceMessage:
+		if err := c.SetTrackSourceType(m.TrackID, m.Source); err != nil {
+			c.log.Debugf("client: source of track %s not set: %s", m.TrackID, err.Error())
+		}
+	case *SetMetadataMessage:
+		if err := c.onMetadataMessage(m); err != nil {
+			c.log.Debugf("client: %s from %s failed: %s", m.Type, c.ID(), err.Error())
+		}
+	case *RequestRenegotiationMessage:
+		c.renegotiate()
+	default:
+		c.log.Debugf("client: unhandled internal message type %s", internalMessage.InternalMessageType())
+	}
+}
+
+// VoiceThresholds returns the voice threshold of every published audio stream by
+// SSRC, they change over time when the adaptive voice detection is enabled.
+func (c *Client) VoiceThresholds() map[uint32]uint8 {
+	if c.vadInterceptor == nil {
+		return map[uint32]uint8{}
+	}
+
+	return c.vadInterceptor.Thresholds()
+}
+
+func (c *Client) IngressBandwith() uint32 {
+	return c.ingressBandwith.Load()
+}
+
+func (c *Client) IngressQualityLimitationReason() string {
+	return c.ingressQualityLimitationReason.Load().(string)
+}
+
 func registerInterceptors(m *webrtc.MediaEngine, interceptorRegistry *interceptor.Registry) error {
 	generator, err := nack.NewGeneratorInterceptor()
 	if err != nil {
@@ -254,11 +1306,13 @@ func registerInterceptors(m *webrtc.MediaEngine, interceptorRegistry *intercepto
 	return webrtc.ConfigureTWCCSender(m, interceptorRegistry)
 }
 
+// GetEstimatedBandwith doesn't lock the client, the estimator is set once in
+// NewClient and does its own locking. Without an estimator the bandwidth is
+// unlimited so every subscription gets its highest quality.
 func (c *Client) GetEstimatedBandwith() uint32 {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
 	if c.estimator == nil {
-		return c.sfu
+		return math.MaxUint32
 	}
+
+	return c.estimator.GetTargetBitrate()
 }
@@ -0,0 +1,148 @@
+package meetup
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/pion/webrtc/v4"
+)
+
+func newTestSFU() *SFU {
+	return &SFU{clients: &SFUClients{clients: make(map[string]*Client), mu: sync.Mutex{}}}
+}
+
+// newTestRoomClient adds a client to the SFU without a peer connection, enough
+// for the code paths that don't negotiate.
+func newTestRoomClient(s *SFU, id string, opts ClientOptions) *Client {
+	c := newTestInternalMessageClient()
+	c.id = id
+	c.sfu = s
+	c.options = opts
+	c.publishedTracks = newTrackList()
+	c.clientTracks = make(map[string]iClientTrack)
+	c.pinnedTracks = make(map[string]bool)
+	c.lastN = &atomic.Int32{}
+	c.bitrateController = &bitrateController{client: c}
+	c.permissions = newTestPublisher(DefaultPermissions()).permissions
+
+	if err := s.clients.Add(c); err != nil {
+		panic(err)
+	}
+
+	return c
+}
+
+func newTestClientPublishedTrack(c *Client, id string, kind webrtc.RTPCodecType) *Track {
+	track := newTestPublishedTrack(id, kind, TrackTypeMedia)
+	track.client = c
+	track.clientTracks = newClientTrackList()
+
+	if err := c.publishedTracks.Add(track); err != nil {
+		panic(err)
+	}
+
+	return track
+}
+
+func TestSubscribeTracksErrors(t *testing.T) {
+	s := newTestSFU()
+	alice := newTestRoomClient(s, "alice", ClientOptions{})
+	bob := newTestRoomClient(s, "bob", ClientOptions{})
+
+	newTestClientPublishedTrack(alice, "alice-video", webrtc.RTPCodecTypeVideo)
+	newTestClientPublishedTrack(bob, "bob-video", webrtc.RTPCodecTypeVideo)
+
+	// the own track is skipped, the unknown ones fail, nothing is renegotiated
+	err := bob.SubscribeTracks([]SubscribeRequest{
+		{ClientID: "bob", TrackID: "bob-video"},
+		{ClientID: "carol", TrackID: "carol-video"},
+		{ClientID: "alice", TrackID: "alice-audio"},
+	})
+
+	// the errors are flattened into one message
+	if err == nil || !strings.Contains(err.Error(), ErrClientNotFound.Error()) || !strings.Contains(err.Error(), ErrTrackIsNotExists.Error()) {
+		t.Errorf("SubscribeTracks = %v, want %v and %v", err, ErrClientNotFound, ErrTrackIsNotExists)
+	}
+
+	if len(bob.ClientTracks()) != 0 {
+		t.Errorf("client tracks = %d, want 0", len(bob.ClientTracks()))
+	}
+
+	bob.permissions.Store(Permissions{})
+
+	if err := bob.SubscribeTracks([]SubscribeRequest{{ClientID: "alice", TrackID: "alice-video"}}); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("SubscribeTracks without the permission = %v, want %v", err, ErrPermissionDenied)
+	}
+
+	bob.state.Store(ClientStateEnded)
+
+	if err := bob.SubscribeTracks(nil); !errors.Is(err, ErrClientStopped) {
+		t.Errorf("SubscribeTracks of an ended client = %v, want %v", err, ErrClientStopped)
+	}
+}
+
+func TestUnsubscribeTracksChecksPublisher(t *testing.T) {
+	s := newTestSFU()
+	alice := newTestRoomClient(s, "alice", ClientOptions{})
+	bob := newTestRoomClient(s, "bob", ClientOptions{})
+
+	ct := newTestClientTrack()
+	ct.id = "alice-video"
+	ct.track = newTestClientPublishedTrack(alice, "alice-video", webrtc.RTPCodecTypeVideo)
+	bob.clientTracks[ct.ID()] = ct
+
+	err := bob.UnsubscribeTracks([]SubscribeRequest{
+		{ClientID: "carol", TrackID: "alice-video"},
+		{ClientID: "alice", TrackID: "missing"},
+	})
+
+	if err == nil || strings.Count(err.Error(), ErrTrackIsNotExists.Error()) != 2 {
+		t.Errorf("UnsubscribeTracks = %v, want %v", err, ErrTrackIsNotExists)
+	}
+
+	if _, err := bob.getClientTrack("alice-video"); err != nil {
+		t.Error("a request naming another publisher shouldn't remove the subscription")
+	}
+}
+
+func TestTrackAvailableWithoutAutoSubscribe(t *testing.T) {
+	s := newTestSFU()
+	alice := newTestRoomClient(s, "alice", ClientOptions{})
+	bob := newTestRoomClient(s, "bob", ClientOptions{})
+	viewer := newTestRoomClient(s, "viewer", ClientOptions{})
+	viewer.permissions.Store(Permissions{})
+
+	announced := make([]TrackInfo, 0)
+	bob.OnTracksAvailable(func(tracks []ITrack) {
+		for _, track := range tracks {
+			announced = append(announced, NewTrackInfo(track))
+		}
+	})
+
+	viewer.OnTracksAvailable(func([]ITrack) {
+		t.Error("a client that can't subscribe shouldn't be told about tracks")
+	})
+
+	track := newTestClientPublishedTrack(alice, "alice-video", webrtc.RTPCodecTypeVideo)
+	s.onTrackAvailable(track)
+
+	want := TrackInfo{ClientID: "alice", TrackID: "alice-video", Kind: "video", SourceType: TrackTypeMedia}
+	if len(announced) != 1 || announced[0] != want {
+		t.Errorf("announced = %+v, want [%+v]", announced, want)
+	}
+
+	if len(bob.ClientTracks()) != 0 {
+		t.Error("a client without auto subscribe shouldn't be subscribed")
+	}
+
+	if tracks := bob.AvailableTracks(); len(tracks) != 1 || tracks[0] != ITrack(track) {
+		t.Errorf("available tracks = %v, want the published track", tracks)
+	}
+
+	if tracks := alice.AvailableTracks(); len(tracks) != 0 {
+		t.Errorf("available tracks of the publisher = %v, want none", tracks)
+	}
+}
@@ -3,13 +3,17 @@ package meetup
 import (
 	"context"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/pion/rtcp"
 	"github.com/pion/rtp"
 	"github.com/pion/webrtc/v4"
 )
 
 type iClientTrack interface {
 	push(rtp *rtp.Packet, quality QualityLevel)
+	skip()
 	ID() string
 	StreamID() string
 	Context() context.Context
@@ -21,23 +25,456 @@ type iClientTrack interface {
 	IsScaleable() bool
 	SetSourceType(TrackType)
 	Client() *Client
+	Track() ITrack
 	RequestPLI()
 	SetMaxQuality(quality QualityLevel)
 	MaxQuality() QualityLevel
 	ReceiveBitrate() uint32
 	SendBitrate() uint32
 	Quality() QualityLevel
+	Sender() *webrtc.RTPSender
+	IsPaused() bool
 	OnEnded(func())
+	end()
+	pause(reason uint32) bool
+	resume(reason uint32) bool
 }
 
+const (
+	pauseReasonSubscriber = uint32(1 << iota)
+	pauseReasonLastN
+	pauseReasonMuted
+)
+
 type clientTrack struct {
-	id         string
-	streamid   string
-	context    context.Context
-	mu         sync.RWMutex
-	client     *Client
-	kind       webrtc.RTPCodecType
-	mineType   string
-	localTrack *webrtc.TrackLocalStaticRTP
-	remoteTrack
+	id               string
+	streamid         string
+	context          context.Context
+	cancel           context.CancelFunc
+	mu               sync.RWMutex
+	client           *Client
+	kind             webrtc.RTPCodecType
+	mineType         string
+	localTrack       *webrtc.TrackLocalStaticRTP
+	sender           *webrtc.RTPSender
+	rtcpTarget       *atomic.Pointer[clientTrack]
+	track            ITrack
+	maxQuality       *atomic.Uint32
+	pausedReasons    *atomic.Uint32
+	currentQuality   QualityLevel
+	seqOffset        uint16
+	tsOffset         uint32
+	lastSeq          uint16
+	lastTS           uint32
+	lastWrite        time.Time
+	bytesSent        *atomic.Uint64
+	lastBytesSent    uint64
+	lastBitrateCheck time.Time
+	bitrate          uint32
+	onEndedCallbacks []func()
+}
+
+func newClientTrack(client *Client, track ITrack, localTrack *webrtc.TrackLocalStaticRTP, sender *webrtc.RTPSender) *clientTrack {
+	localCtx, cancel := context.WithCancel(client.Context())
+
+	var maxQuality atomic.Uint32
+	maxQuality.Store(QualityHigh)
+
+	ct := &clientTrack{
+		id:               track.ID(),
+		streamid:         track.StreamID(),
+		context:          localCtx,
+		cancel:           cancel,
+		mu:               sync.RWMutex{},
+		client:           client,
+		kind:             track.Kind(),
+		mineType:         track.MimeType(),
+		localTrack:       localTrack,
+		sender:           sender,
+		rtcpTarget:       &atomic.Pointer[clientTrack]{},
+		track:            track,
+		maxQuality:       &maxQuality,
+		pausedReasons:    &atomic.Uint32{},
+		currentQuality:   QualityNone,
+		bytesSent:        &atomic.Uint64{},
+		lastBitrateCheck: time.Now(),
+		onEndedCallbacks: make([]func(), 0),
+	}
+
+	ct.rtcpTarget.Store(ct)
+
+	return ct
+}
+
+// readRTCP reads the RTCP of the sender until it stops or its client track ends.
+// It is started once per sender, a client track continuing from another one on
+// the same sender takes over the reader in continueFrom.
+func (t *clientTrack) readRTCP() {
+	for {
+		pkts, _, err := t.sender.ReadRTCP()
+		if err != nil {
+			return
+		}
+
+		target := t.rtcpTarget.Load()
+		if target.context.Err() != nil {
+			return
+		}
+
+		for _, pkt := range pkts {
+			switch pkt.(type) {
+			case *rtcp.PictureLossIndication, *rtcp.FullIntraRequest:
+				target.RequestPLI()
+			}
+		}
+	}
+}
+
+func (t *clientTrack) push(p *rtp.Packet, quality QualityLevel) {
+	if t.context.Err() != nil || t.IsPaused() {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.IsSimulcast() {
+		// first packet or first packet after a resume, video has to start on a keyframe
+		if t.currentQuality != quality {
+			if t.kind == webrtc.RTPCodecTypeVideo && !IsKeyframe(t.mineType, p.Payload) {
+				t.track.SendPLI()
+				return
+			}
+
+			t.switchLayer(p, quality)
+		}
+
+		t.write(p)
+
+		return
+	}
+
+	target := simulcastLayer(t.Quality())
+	if target == QualityNone {
+		return
+	}
+
+	if quality == target && quality != t.currentQuality {
+		if !IsKeyframe(t.mineType, p.Payload) {
+			t.track.SendPLI()
+
+			if t.currentQuality == QualityNone {
+				return
+			}
+		} else {
+			t.switchLayer(p, quality)
+		}
+	}
+
+	if quality != t.currentQuality {
+		return
+	}
+
+	t.write(p)
+}
+
+// skip is called for a packet the SFU drops before it reaches the track, the
+// following packets are shifted so the subscriber doesn't see the drop as loss.
+func (t *clientTrack) skip() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.currentQuality == QualityNone {
+		return
+	}
+
+	t.seqOffset--
+}
+
+func (t *clientTrack) switchLayer(p *rtp.Packet, quality QualityLevel) {
+	t.currentQuality = quality
+
+	if t.lastWrite.IsZero() {
+		return
+	}
+
+	elapsed := uint32(time.Since(t.lastWrite).Seconds() * float64(t.track.Codec().ClockRate))
+	if elapsed == 0 {
+		elapsed = 1
+	}
+
+	t.seqOffset = t.lastSeq + 1 - p.SequenceNumber
+	t.tsOffset = t.lastTS + elapsed - p.Timestamp
+}
+
+// continueFrom carries the sequence numbers and timestamps of the previous
+// client track of the same sender, the next keyframe is rebased after them. The
+// track also takes over the RTCP reader of the sender and the pauses of the
+// subscriber, the mute pause follows the new published track.
+func (t *clientTrack) continueFrom(prev iClientTrack) {
+	previous, ok := prev.(*clientTrack)
+	if !ok {
+		return
+	}
+
+	previous.mu.RLock()
+	defer previous.mu.RUnlock()
+
+	t.lastSeq = previous.lastSeq
+	t.lastTS = previous.lastTS
+	t.lastWrite = previous.lastWrite
+	t.maxQuality.Store(uint32(previous.MaxQuality()))
+	t.pausedReasons.Store(previous.pausedReasons.Load() &^ pauseReasonMuted)
+
+	t.rtcpTarget = previous.rtcpTarget
+	t.rtcpTarget.Store(t)
+}
+
+func (t *clientTrack) write(p *rtp.Packet) {
+	pkt := *p
+	pkt.Header.SequenceNumber += t.seqOffset
+	pkt.Header.Timestamp += t.tsOffset
+
+	if err := t.localTrack.WriteRTP(&pkt); err != nil {
+		t.client.log.Tracef("clienttrack: write error: %s", err.Error())
+		return
+	}
+
+	t.lastSeq = pkt.Header.SequenceNumber
+	t.lastTS = pkt.Header.Timestamp
+	t.lastWrite = time.Now()
+	t.bytesSent.Add(uint64(pkt.MarshalSize()))
+}
+
+func (t *clientTrack) ID() string {
+	return t.id
+}
+
+func (t *clientTrack) StreamID() string {
+	return t.streamid
+}
+
+func (t *clientTrack) Context() context.Context {
+	return t.context
+}
+
+func (t *clientTrack) Kind() webrtc.RTPCodecType {
+	return t.kind
+}
+
+func (t *clientTrack) MimeType() string {
+	return t.mineType
+}
+
+func (t *clientTrack) Localtrack() *webrtc.TrackLocalStaticRTP {
+	return t.localTrack
+}
+
+func (t *clientTrack) IsScreen() bool {
+	return t.track.IsScreen()
+}
+
+func (t *clientTrack) IsSimulcast() bool {
+	return t.track.IsSimulcast()
+}
+
+func (t *clientTrack) IsScaleable() bool {
+	return t.track.IsScaleable()
+}
+
+func (t *clientTrack) SetSourceType(sourceType TrackType) {
+	t.track.SetSourceType(sourceType)
+}
+
+func (t *clientTrack) Client() *Client {
+	return t.client
+}
+
+func (t *clientTrack) Track() ITrack {
+	return t.track
+}
+
+func (t *clientTrack) Sender() *webrtc.RTPSender {
+	return t.sender
+}
+
+func (t *clientTrack) RequestPLI() {
+	t.track.SendPLI()
+}
+
+func (t *clientTrack) SetMaxQuality(quality QualityLevel) {
+	t.maxQuality.Store(uint32(quality))
+}
+
+func (t *clientTrack) MaxQuality() QualityLevel {
+	return QualityLevel(t.maxQuality.Load())
+}
+
+func (t *clientTrack) ReceiveBitrate() uint32 {
+	return t.track.ReceiveBitrate()
+}
+
+func (t *clientTrack) SendBitrate() uint32 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	elapsed := time.Since(t.lastBitrateCheck)
+	if elapsed < time.Second {
+		return t.bitrate
+	}
+
+	current := t.bytesSent.Load()
+	t.bitrate = uint32(float64(current-t.lastBytesSent) * 8 / elapsed.Seconds())
+	t.lastBytesSent = current
+	t.lastBitrateCheck = time.Now()
+
+	return t.bitrate
+}
+
+func (t *clientTrack) IsPaused() bool {
+	return t.pausedReasons.Load() != 0
+}
+
+// pause adds a reason for the track to be paused and reports whether the track
+// went from forwarding to paused.
+func (t *clientTrack) pause(reason uint32) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	reasons := t.pausedReasons.Load()
+	t.pausedReasons.Store(reasons | reason)
+
+	return reasons == 0
+}
+
+// resume removes a pause reason and reports whether the track is forwarding
+// again. The sequence numbers and timestamps are rebased on the next keyframe so
+// the subscriber doesn't see the pause as loss.
+func (t *clientTrack) resume(reason uint32) bool {
+	t.mu.Lock()
+
+	reasons := t.pausedReasons.Load()
+	if reasons&reason == 0 {
+		t.mu.Unlock()
+		return false
+	}
+
+	t.pausedReasons.Store(reasons &^ reason)
+
+	if reasons&^reason != 0 {
+		t.mu.Unlock()
+		return false
+	}
+
+	t.currentQuality = QualityNone
+	t.mu.Unlock()
+
+	t.RequestPLI()
+
+	return true
+}
+
+func (t *clientTrack) Quality() QualityLevel {
+	if t.IsPaused() {
+		return QualityNone
+	}
+
+	maxQuality := t.MaxQuality()
+
+	claim := t.client.bitrateController.GetClaim(t.ID())
+	if claim == nil {
+		return maxQuality
+	}
+
+	return min(claim.Quality(), maxQuality)
+}
+
+func (t *clientTrack) OnEnded(callback func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.onEndedCallbacks = append(t.onEndedCallbacks, callback)
+}
+
+func (t *clientTrack) end() {
+	t.cancel()
+
+	t.mu.RLock()
+	callbacks := t.onEndedCallbacks
+	t.mu.RUnlock()
+
+	for _, callback := range callbacks {
+		callback()
+	}
+}
+
+// simulcastLayer maps a quality level to the simulcast layer carrying it, the
+// sub levels are temporal layers of the same encoding.
+func simulcastLayer(quality QualityLevel) QualityLevel {
+	switch {
+	case quality >= QualityHighLow:
+		return QualityHigh
+	case quality >= QualityMidLow:
+		return QualityMid
+	case quality >= QualityLowLow:
+		return QualityLow
+	default:
+		return QualityNone
+	}
+}
+
+type clientTrackList struct {
+	mu     sync.RWMutex
+	tracks map[string]iClientTrack
+}
+
+func newClientTrackList() *clientTrackList {
+	return &clientTrackList{
+		mu:     sync.RWMutex{},
+		tracks: make(map[string]iClientTrack),
+	}
+}
+
+func (l *clientTrackList) Add(clientID string, track iClientTrack) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.tracks[clientID] = track
+}
+
+func (l *clientTrackList) Remove(clientID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.tracks, clientID)
+}
+
+func (l *clientTrackList) GetTracks() []iClientTrack {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	tracks := make([]iClientTrack, 0, len(l.tracks))
+	for _, track := range l.tracks {
+		tracks = append(tracks, track)
+	}
+
+	return tracks
+}
+
+func (l *clientTrackList) push(p *rtp.Packet, quality QualityLevel) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	for _, track := range l.tracks {
+		track.push(p, quality)
+	}
+}
+
+func (l *clientTrackList) skip() {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	for _, track := range l.tracks {
+		track.skip()
+	}
 }
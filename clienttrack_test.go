@@ -0,0 +1,130 @@
+package meetup
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+)
+
+func newTestClientTrack() *clientTrack {
+	ct := &clientTrack{
+		maxQuality:    &atomic.Uint32{},
+		pausedReasons: &atomic.Uint32{},
+		rtcpTarget:    &atomic.Pointer[clientTrack]{},
+		bytesSent:     &atomic.Uint64{},
+	}
+
+	ct.rtcpTarget.Store(ct)
+
+	return ct
+}
+
+func TestClientTrackContinueFrom(t *testing.T) {
+	previous := newTestClientTrack()
+	previous.lastSeq = 100
+	previous.lastTS = 9000
+	previous.maxQuality.Store(QualityMid)
+	previous.pausedReasons.Store(pauseReasonSubscriber | pauseReasonMuted)
+
+	ct := newTestClientTrack()
+	ct.continueFrom(previous)
+
+	if ct.lastSeq != 100 || ct.lastTS != 9000 {
+		t.Errorf("last sequence number and timestamp = %d, %d, want 100, 9000", ct.lastSeq, ct.lastTS)
+	}
+
+	if ct.MaxQuality() != QualityMid {
+		t.Errorf("max quality = %d, want %d", ct.MaxQuality(), QualityMid)
+	}
+
+	if reasons := ct.pausedReasons.Load(); reasons != pauseReasonSubscriber {
+		t.Errorf("paused reasons = %b, want only the subscriber pause %b", reasons, pauseReasonSubscriber)
+	}
+
+	if ct.rtcpTarget != previous.rtcpTarget {
+		t.Error("the track should share the RTCP reader of the previous track")
+	}
+
+	if ct.rtcpTarget.Load() != ct {
+		t.Error("the RTCP reader should forward to the new track")
+	}
+}
+
+func TestClientTrackPauseReasons(t *testing.T) {
+	ct := newTestClientTrack()
+
+	if !ct.pause(pauseReasonSubscriber) {
+		t.Error("the first pause should stop the forwarding")
+	}
+
+	if ct.pause(pauseReasonLastN) {
+		t.Error("a second pause reason shouldn't report a change")
+	}
+
+	if ct.resume(pauseReasonLastN) {
+		t.Error("the track should stay paused while the subscriber pause is set")
+	}
+
+	if ct.resume(pauseReasonLastN) {
+		t.Error("resuming a reason that isn't set shouldn't report a change")
+	}
+
+	if !ct.IsPaused() || ct.Quality() != QualityNone {
+		t.Errorf("paused = %v with quality %d, want paused with no quality", ct.IsPaused(), ct.Quality())
+	}
+}
+
+func TestPauseAndResumeTrack(t *testing.T) {
+	ct := newTestClientTrack()
+	ct.id = "video"
+	ct.kind = webrtc.RTPCodecTypeVideo
+	ct.context = context.Background()
+	ct.track = newTestPublishedTrack("video", webrtc.RTPCodecTypeVideo, TrackTypeMedia)
+	ct.maxQuality.Store(QualityHigh)
+	ct.currentQuality = QualityHigh
+
+	bc := newTestBitrateController(DefaultBitrates(), ct)
+	bc.addClaim(ct, QualityHigh)
+
+	c := bc.client
+
+	if err := c.PauseTrack("video"); err != nil {
+		t.Fatal(err)
+	}
+
+	if bc.GetClaim("video") != nil {
+		t.Error("a paused track should release its bitrate claim")
+	}
+
+	// nothing is written while paused, the local track isn't even set
+	ct.push(&rtp.Packet{Header: rtp.Header{SequenceNumber: 1}}, QualityHigh)
+
+	if ct.bytesSent.Load() != 0 {
+		t.Errorf("bytes sent = %d while paused, want 0", ct.bytesSent.Load())
+	}
+
+	if err := c.ResumeTrack("video"); err != nil {
+		t.Fatal(err)
+	}
+
+	if ct.IsPaused() {
+		t.Error("the track should forward after the resume")
+	}
+
+	if bc.GetClaim("video") == nil {
+		t.Error("a resumed track should claim bitrate again")
+	}
+
+	// the next packet must be a keyframe to switch back to the layer
+	if ct.currentQuality != QualityNone {
+		t.Errorf("current quality = %d after the resume, want %d", ct.currentQuality, QualityNone)
+	}
+
+	if err := c.PauseTrack("missing"); !errors.Is(err, ErrTrackIsNotExists) {
+		t.Errorf("PauseTrack of a missing track = %v, want %v", err, ErrTrackIsNotExists)
+	}
+}
@@ -0,0 +1,466 @@
+package meetup
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+var (
+	ErrDataChannelExists   = errors.New("sfu: error data channel already exists")
+	ErrDataChannelNotFound = errors.New("sfu: error data channel not found")
+	ErrDataChannelLimit    = errors.New("sfu: error too many data channels")
+)
+
+// DataChannelOptions are the options of a room data channel. The messages go to
+// every client that can subscribe, or only to ClientIDs when set, and the last
+// HistorySize messages are replayed to the clients that join later.
+type DataChannelOptions struct {
+	Ordered           bool
+	MaxRetransmits    *uint16
+	MaxPacketLifeTime *uint16
+	ClientIDs         []string
+	HistorySize       int
+}
+
+func DefaultDataChannelOptions() DataChannelOptions {
+	return DataChannelOptions{
+		Ordered: true,
+	}
+}
+
+// DataMessage is a message relayed on a room data channel, ClientID is empty
+// for the messages sent by the server. The receivers get it as JSON with the
+// binary data base64 encoded.
+type DataMessage struct {
+	Label    string
+	ClientID string
+	Data     []byte
+	IsString bool
+	Time     time.Time
+}
+
+type dataMessageEnvelope struct {
+	Label    string    `json:"label"`
+	ClientID string    `json:"client_id,omitempty"`
+	Data     string    `json:"data"`
+	Binary   bool      `json:"binary,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+func (m DataMessage) MarshalJSON() ([]byte, error) {
+	envelope := dataMessageEnvelope{
+		Label:    m.Label,
+		ClientID: m.ClientID,
+		Data:     string(m.Data),
+		Binary:   !m.IsString,
+		Time:     m.Time,
+	}
+
+	if envelope.Binary {
+		envelope.Data = base64.StdEncoding.EncodeToString(m.Data)
+	}
+
+	return json.Marshal(envelope)
+}
+
+type SFUDataChannel struct {
+	label   string
+	options DataChannelOptions
+	mu      sync.Mutex
+	history []DataMessage
+}
+
+func (d *SFUDataChannel) Label() string {
+	return d.label
+}
+
+func (d *SFUDataChannel) Options() DataChannelOptions {
+	return d.options
+}
+
+// History returns the kept messages, the oldest first.
+func (d *SFUDataChannel) History() []DataMessage {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	history := make([]DataMessage, len(d.history))
+	copy(history, d.history)
+
+	return history
+}
+
+func (d *SFUDataChannel) addHistory(msg DataMessage) {
+	if d.options.HistorySize <= 0 {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(d.history) == d.options.HistorySize {
+		d.history = append(d.history[:0], d.history[1:]...)
+	}
+
+	d.history = append(d.history, msg)
+}
+
+func (d *SFUDataChannel) isTarget(clientID string) bool {
+	if len(d.options.ClientIDs) == 0 {
+		return true
+	}
+
+	for _, id := range d.options.ClientIDs {
+		if id == clientID {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (d *SFUDataChannel) init() *webrtc.DataChannelInit {
+	ordered := d.options.Ordered
+
+	return &webrtc.DataChannelInit{
+		Ordered:           &ordered,
+		MaxRetransmits:    d.options.MaxRetransmits,
+		MaxPacketLifeTime: d.options.MaxPacketLifeTime,
+	}
+}
+
+type SFUDataChannelList struct {
+	mu       sync.Mutex
+	channels map[string]*SFUDataChannel
+}
+
+func NewSFUDataChannelList() *SFUDataChannelList {
+	return &SFUDataChannelList{
+		mu:       sync.Mutex{},
+		channels: make(map[string]*SFUDataChannel),
+	}
+}
+
+func (l *SFUDataChannelList) Add(label string, opts DataChannelOptions) (*SFUDataChannel, error) {
+	return l.add(label, opts, 0)
+}
+
+// add adds the channel unless the list already has limit channels, a limit of 0 is
+// no limit.
+func (l *SFUDataChannelList) add(label string, opts DataChannelOptions, limit int) (*SFUDataChannel, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.channels[label]; ok {
+		return nil, ErrDataChannelExists
+	}
+
+	if limit > 0 && len(l.channels) >= limit {
+		return nil, ErrDataChannelLimit
+	}
+
+	channel := &SFUDataChannel{
+		label:   label,
+		options: opts,
+		mu:      sync.Mutex{},
+		history: make([]DataMessage, 0),
+	}
+
+	l.channels[label] = channel
+
+	return channel, nil
+}
+
+func (l *SFUDataChannelList) Get(label string) (*SFUDataChannel, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	channel, ok := l.channels[label]
+	if !ok {
+		return nil, ErrDataChannelNotFound
+	}
+
+	return channel, nil
+}
+
+func (l *SFUDataChannelList) Remove(label string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.channels[label]; !ok {
+		return ErrDataChannelNotFound
+	}
+
+	delete(l.channels, label)
+
+	return nil
+}
+
+func (l *SFUDataChannelList) GetAll() []*SFUDataChannel {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	channels := make([]*SFUDataChannel, 0, len(l.channels))
+	for _, channel := range l.channels {
+		channels = append(channels, channel)
+	}
+
+	return channels
+}
+
+// CreateDataChannel adds a room data channel and opens it on the clients, a
+// client can also add one by opening a channel with a new label.
+func (s *SFU) CreateDataChannel(label string, opts DataChannelOptions) error {
+	if label == internalDataChannelLabel {
+		return ErrDataChannelExists
+	}
+
+	channel, err := s.dataChannels.Add(label, opts)
+	if err != nil {
+		return err
+	}
+
+	for _, client := range s.clients.GetClients() {
+		client.openDataChannel(channel)
+	}
+
+	return nil
+}
+
+// CloseDataChannel removes a room data channel and closes it on the clients.
+func (s *SFU) CloseDataChannel(label string) error {
+	if err := s.dataChannels.Remove(label); err != nil {
+		return err
+	}
+
+	for _, client := range s.clients.GetClients() {
+		client.closeDataChannel(label)
+	}
+
+	return nil
+}
+
+func (s *SFU) DataChannels() []*SFUDataChannel {
+	return s.dataChannels.GetAll()
+}
+
+func (s *SFU) OnDataMessage(callback func(DataMessage)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.onDataMessageCallbacks = append(s.onDataMessageCallbacks, callback)
+}
+
+// SendData sends a server message to one client on a room data channel, it is
+// not kept in the history.
+func (s *SFU) SendData(clientID, label string, msg webrtc.DataChannelMessage) error {
+	if _, err := s.dataChannels.Get(label); err != nil {
+		return err
+	}
+
+	client, err := s.clients.GetClient(clientID)
+	if err != nil {
+		return err
+	}
+
+	return client.sendData(DataMessage{
+		Label:    label,
+		Data:     msg.Data,
+		IsString: msg.IsString,
+		Time:     time.Now(),
+	})
+}
+
+// BroadcastData sends a server message to the clients of a room data channel.
+func (s *SFU) BroadcastData(label string, msg webrtc.DataChannelMessage) error {
+	channel, err := s.dataChannels.Get(label)
+	if err != nil {
+		return err
+	}
+
+	s.relayData(channel, DataMessage{
+		Label:    label,
+		Data:     msg.Data,
+		IsString: msg.IsString,
+		Time:     time.Now(),
+	})
+
+	return nil
+}
+
+func (s *SFU) relayData(channel *SFUDataChannel, msg DataMessage) {
+	channel.addHistory(msg)
+
+	for _, client := range s.clients.GetClients() {
+		if client.ID() == msg.ClientID || !channel.isTarget(client.ID()) || !client.Permissions().CanSubscribe {
+			continue
+		}
+
+		if err := client.sendData(msg); err != nil {
+			s.log.Debugf("sfu: failed to relay data on %s to client %s: %s", channel.label, client.ID(), err.Error())
+		}
+	}
+
+	if msg.ClientID == "" {
+		return
+	}
+
+	s.mu.Lock()
+	callbacks := s.onDataMessageCallbacks
+	s.mu.Unlock()
+
+	for _, callback := range callbacks {
+		callback(msg)
+	}
+}
+
+// onClientDataChannel relays a channel opened by the client, a new label adds a
+// room data channel with the options of the client channel. A client waiting in
+// the lobby or without the permission to publish data can't open channels, and
+// the room keeps at most maxDataChannels of them.
+func (c *Client) onClientDataChannel(dc *webrtc.DataChannel) {
+	if c.waiting.Load() || !c.Permissions().CanPublishData {
+		c.log.Warnf("client: %s is not allowed to publish data, closing data channel %s", c.ID(), dc.Label())
+		_ = dc.Close()
+
+		return
+	}
+
+	channel, err := c.sfu.dataChannels.Get(dc.Label())
+	added := false
+
+	if err != nil {
+		opts := DefaultDataChannelOptions()
+		opts.Ordered = dc.Ordered()
+		opts.MaxRetransmits = dc.MaxRetransmits()
+		opts.MaxPacketLifeTime = dc.MaxPacketLifeTime()
+		opts.HistorySize = c.sfu.dataChannelHistory
+
+		channel, err = c.sfu.dataChannels.add(dc.Label(), opts, c.sfu.maxDataChannels)
+		if errors.Is(err, ErrDataChannelExists) {
+			channel, err = c.sfu.dataChannels.Get(dc.Label())
+		} else {
+			added = err == nil
+		}
+	}
+
+	if err != nil {
+		c.log.Errorf("client: error adding data channel %s: %s", dc.Label(), err.Error())
+		_ = dc.Close()
+
+		return
+	}
+
+	c.setDataChannel(channel, dc)
+
+	if !added {
+		return
+	}
+
+	for _, client := range c.sfu.clients.GetClients() {
+		if client.ID() != c.ID() {
+			client.openDataChannel(channel)
+		}
+	}
+}
+
+// openDataChannel opens a room data channel on the client once its SCTP
+// transport is up, the internal data channel being open tells it is.
+func (c *Client) openDataChannel(channel *SFUDataChannel) {
+	if !channel.isTarget(c.ID()) || !c.Permissions().CanSubscribe {
+		return
+	}
+
+	c.mu.Lock()
+	internal := c.internalDataChannel
+	_, exists := c.dataChannels[channel.label]
+	c.mu.Unlock()
+
+	if exists || internal == nil || internal.ReadyState() != webrtc.DataChannelStateOpen {
+		return
+	}
+
+	dc, err := c.peerConnection.PC().CreateDataChannel(channel.label, channel.init())
+	if err != nil {
+		c.log.Errorf("client: error creating data channel %s: %s", channel.label, err.Error())
+		return
+	}
+
+	c.setDataChannel(channel, dc)
+}
+
+func (c *Client) openDataChannels() {
+	for _, channel := range c.sfu.dataChannels.GetAll() {
+		c.openDataChannel(channel)
+	}
+}
+
+func (c *Client) setDataChannel(channel *SFUDataChannel, dc *webrtc.DataChannel) {
+	c.mu.Lock()
+	c.dataChannels[channel.label] = dc
+	c.mu.Unlock()
+
+	dc.OnOpen(func() {
+		for _, msg := range channel.History() {
+			if err := c.sendData(msg); err != nil {
+				c.log.Debugf("client: failed to send history of %s to %s: %s", channel.label, c.ID(), err.Error())
+				return
+			}
+		}
+	})
+
+	dc.OnMessage(func(msg webrtc.DataChannelMessage) {
+		if !c.Permissions().CanPublishData {
+			return
+		}
+
+		c.sfu.relayData(channel, DataMessage{
+			Label:    channel.label,
+			ClientID: c.ID(),
+			Data:     msg.Data,
+			IsString: msg.IsString,
+			Time:     time.Now(),
+		})
+	})
+
+	dc.OnClose(func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		if c.dataChannels[channel.label] == dc {
+			delete(c.dataChannels, channel.label)
+		}
+	})
+}
+
+func (c *Client) closeDataChannel(label string) {
+	c.mu.Lock()
+	dc, ok := c.dataChannels[label]
+	delete(c.dataChannels, label)
+	c.mu.Unlock()
+
+	if ok {
+		_ = dc.Close()
+	}
+}
+
+func (c *Client) sendData(msg DataMessage) error {
+	c.mu.Lock()
+	dc := c.dataChannels[msg.Label]
+	c.mu.Unlock()
+
+	if dc == nil || dc.ReadyState() != webrtc.DataChannelStateOpen {
+		return ErrDataChannelNotReady
+	}
+
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return ErrEncodingData
+	}
+
+	return dc.SendText(string(payload))
+}
@@ -0,0 +1,105 @@
+package meetup
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/pion/webrtc/v4"
+)
+
+func newTestDataChannel(t *testing.T, label string) *webrtc.DataChannel {
+	t.Helper()
+
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { _ = pc.Close() })
+
+	dc, err := pc.CreateDataChannel(label, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return dc
+}
+
+func TestClientDataChannel(t *testing.T) {
+	noData := DefaultPermissions()
+	noData.CanPublishData = false
+
+	testCases := []struct {
+		name        string
+		permissions Permissions
+		waiting     bool
+		existing    []string
+		label       string
+		want        bool
+	}{
+		{"new channel", DefaultPermissions(), false, nil, "chat", true},
+		{"without the permission", noData, false, nil, "chat", false},
+		{"waiting in the lobby", DefaultPermissions(), true, nil, "chat", false},
+		{"room at the limit", DefaultPermissions(), false, []string{"a", "b"}, "chat", false},
+		{"existing channel at the limit", DefaultPermissions(), false, []string{"a", "chat"}, "chat", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newTestSFU()
+			s.dataChannels = NewSFUDataChannelList()
+			s.maxDataChannels = 2
+
+			for _, label := range tc.existing {
+				if err := s.CreateDataChannel(label, DefaultDataChannelOptions()); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			alice := newTestRoomClient(s, "alice", ClientOptions{})
+			alice.dataChannels = make(map[string]*webrtc.DataChannel)
+			alice.permissions.Store(tc.permissions)
+			alice.waiting.Store(tc.waiting)
+
+			alice.onClientDataChannel(newTestDataChannel(t, tc.label))
+
+			_, err := s.dataChannels.Get(tc.label)
+			if added := err == nil; added != tc.want {
+				t.Errorf("room channel %s exists = %t, want %t", tc.label, added, tc.want)
+			}
+
+			alice.mu.Lock()
+			_, relayed := alice.dataChannels[tc.label]
+			alice.mu.Unlock()
+
+			if relayed != tc.want {
+				t.Errorf("channel %s relayed = %t, want %t", tc.label, relayed, tc.want)
+			}
+
+			if len(s.DataChannels()) > s.maxDataChannels {
+				t.Errorf("room has %d channels, want at most %d", len(s.DataChannels()), s.maxDataChannels)
+			}
+		})
+	}
+}
+
+func TestDataChannelListLimit(t *testing.T) {
+	l := NewSFUDataChannelList()
+
+	if _, err := l.add("a", DefaultDataChannelOptions(), 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := l.add("b", DefaultDataChannelOptions(), 1); !errors.Is(err, ErrDataChannelLimit) {
+		t.Errorf("add over the limit = %v, want %v", err, ErrDataChannelLimit)
+	}
+
+	if _, err := l.add("a", DefaultDataChannelOptions(), 1); !errors.Is(err, ErrDataChannelExists) {
+		t.Errorf("add of an existing label = %v, want %v", err, ErrDataChannelExists)
+	}
+
+	// the server adds channels without a limit
+	if _, err := l.Add("b", DefaultDataChannelOptions()); err != nil {
+		t.Errorf("Add = %v, want nil", err)
+	}
+}
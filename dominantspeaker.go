@@ -0,0 +1,186 @@
+package meetup
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gautam24s/meetup/pkg/interceptors/voiceactivedetector"
+)
+
+const (
+	speakerTickInterval = 100 * time.Millisecond
+	speakerShortWindow  = 3
+	speakerMediumWindow = 10
+	speakerLongWindow   = 50
+	// a challenger has to be this much more active than the dominant speaker in
+	// every window to take over
+	speakerSwitchRatio = 1.3
+)
+
+type speakerActivity struct {
+	// loudness per tick, most recent last
+	ticks   []float64
+	current float64
+	packets int
+}
+
+func (s *speakerActivity) tick() {
+	loudness := 0.0
+	if s.packets > 0 {
+		loudness = s.current / float64(s.packets)
+	}
+
+	s.ticks = append(s.ticks, loudness)
+	if len(s.ticks) > speakerLongWindow {
+		s.ticks = s.ticks[len(s.ticks)-speakerLongWindow:]
+	}
+
+	s.current = 0
+	s.packets = 0
+}
+
+func (s *speakerActivity) score(window int) float64 {
+	if len(s.ticks) == 0 {
+		return 0
+	}
+
+	start := max(len(s.ticks)-window, 0)
+	total := 0.0
+
+	for _, loudness := range s.ticks[start:] {
+		total += loudness
+	}
+
+	return total / float64(window)
+}
+
+type speakerScores struct {
+	short  float64
+	medium float64
+	long   float64
+}
+
+func (s speakerScores) beats(other speakerScores) bool {
+	if other.medium == 0 {
+		return s.short > 0
+	}
+
+	return s.short > other.short*speakerSwitchRatio &&
+		s.medium > other.medium*speakerSwitchRatio &&
+		s.long > other.long
+}
+
+// dominantSpeaker picks the dominant speaker of the room from the voice activity
+// of every client. The loudness is averaged over a short, medium and long window,
+// and the dominant speaker only changes when a challenger wins in all of them so
+// short noises and interjections don't move the spotlight.
+type dominantSpeaker struct {
+	mu         sync.Mutex
+	sfu        *SFU
+	speakers   map[string]*speakerActivity
+	dominantID string
+	onChanged  func(previousID, currentID string)
+}
+
+func newDominantSpeaker(sfu *SFU, onChanged func(previousID, currentID string)) *dominantSpeaker {
+	return &dominantSpeaker{
+		mu:        sync.Mutex{},
+		sfu:       sfu,
+		speakers:  make(map[string]*speakerActivity),
+		onChanged: onChanged,
+	}
+}
+
+func (d *dominantSpeaker) DominantSpeakerID() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.dominantID
+}
+
+func (d *dominantSpeaker) onVoiceActivity(clientID string, pkts []voiceactivedetector.VoicePacketData) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	speaker, ok := d.speakers[clientID]
+	if !ok {
+		speaker = &speakerActivity{ticks: make([]float64, 0, speakerLongWindow)}
+		d.speakers[clientID] = speaker
+	}
+
+	for _, pkt := range pkts {
+		speaker.current += float64(audioLevelSilence - min(pkt.AudioLevel, audioLevelSilence))
+		speaker.packets++
+	}
+}
+
+func (d *dominantSpeaker) removeClient(clientID string) {
+	d.mu.Lock()
+	delete(d.speakers, clientID)
+
+	if d.dominantID != clientID {
+		d.mu.Unlock()
+		return
+	}
+
+	d.dominantID = ""
+	d.mu.Unlock()
+
+	d.onChanged(clientID, "")
+}
+
+func (d *dominantSpeaker) loop() {
+	ctx, cancel := context.WithCancel(d.sfu.context)
+	defer cancel()
+
+	ticker := time.NewTicker(speakerTickInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.update()
+		}
+	}
+}
+
+func (d *dominantSpeaker) update() {
+	d.mu.Lock()
+
+	scores := make(map[string]speakerScores, len(d.speakers))
+	for id, speaker := range d.speakers {
+		speaker.tick()
+		scores[id] = speakerScores{
+			short:  speaker.score(speakerShortWindow),
+			medium: speaker.score(speakerMediumWindow),
+			long:   speaker.score(speakerLongWindow),
+		}
+	}
+
+	previousID := d.dominantID
+	dominant := scores[previousID]
+	candidateID := ""
+
+	for id, score := range scores {
+		if id == previousID || !score.beats(dominant) {
+			continue
+		}
+
+		if candidateID == "" || score.medium > scores[candidateID].medium {
+			candidateID = id
+		}
+	}
+
+	if candidateID == "" {
+		d.mu.Unlock()
+		return
+	}
+
+	d.dominantID = candidateID
+	d.mu.Unlock()
+
+	d.onChanged(previousID, candidateID)
+}
@@ -0,0 +1,101 @@
+package meetup
+
+import (
+	"testing"
+
+	"github.com/gautam24s/meetup/pkg/interceptors/voiceactivedetector"
+)
+
+type speakerChange struct {
+	previousID string
+	currentID  string
+}
+
+func newTestDominantSpeaker() (*dominantSpeaker, *[]speakerChange) {
+	changes := make([]speakerChange, 0)
+
+	d := newDominantSpeaker(newTestSFU(), func(previousID, currentID string) {
+		changes = append(changes, speakerChange{previousID, currentID})
+	})
+
+	return d, &changes
+}
+
+func speak(d *dominantSpeaker, clientID string, level uint8) {
+	d.onVoiceActivity(clientID, []voiceactivedetector.VoicePacketData{{AudioLevel: level}, {AudioLevel: level}})
+}
+
+func TestSpeakerScoresBeats(t *testing.T) {
+	testCases := []struct {
+		name       string
+		challenger speakerScores
+		dominant   speakerScores
+		want       bool
+	}{
+		{"anyone speaking beats nobody", speakerScores{short: 1}, speakerScores{}, true},
+		{"silence doesn't beat nobody", speakerScores{}, speakerScores{}, false},
+		{"louder in every window", speakerScores{80, 80, 60}, speakerScores{50, 50, 50}, true},
+		{"louder by less than the ratio", speakerScores{60, 60, 60}, speakerScores{50, 50, 50}, false},
+		{"short burst only", speakerScores{100, 30, 10}, speakerScores{50, 50, 50}, false},
+		{"not louder over the long window", speakerScores{80, 80, 40}, speakerScores{50, 50, 50}, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.challenger.beats(tc.dominant); got != tc.want {
+				t.Errorf("beats = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDominantSpeakerSwitch(t *testing.T) {
+	d, changes := newTestDominantSpeaker()
+
+	speak(d, "alice", 30)
+	d.update()
+
+	if d.DominantSpeakerID() != "alice" {
+		t.Fatalf("dominant speaker = %q, want alice", d.DominantSpeakerID())
+	}
+
+	for i := 0; i < speakerLongWindow; i++ {
+		speak(d, "alice", 60)
+		d.update()
+	}
+
+	// a short interjection doesn't move the spotlight
+	for i := 0; i < speakerShortWindow; i++ {
+		speak(d, "alice", 60)
+		speak(d, "bob", 10)
+		d.update()
+	}
+
+	if d.DominantSpeakerID() != "alice" {
+		t.Errorf("dominant speaker = %q after an interjection, want alice", d.DominantSpeakerID())
+	}
+
+	// alice stops, bob keeps talking
+	for i := 0; i < speakerLongWindow && d.DominantSpeakerID() == "alice"; i++ {
+		speak(d, "bob", 10)
+		d.update()
+	}
+
+	if d.DominantSpeakerID() != "bob" {
+		t.Errorf("dominant speaker = %q, want bob", d.DominantSpeakerID())
+	}
+
+	d.removeClient("alice")
+	d.removeClient("bob")
+
+	want := []speakerChange{{"", "alice"}, {"alice", "bob"}, {"bob", ""}}
+	if len(*changes) != len(want) {
+		t.Fatalf("changes = %v, want %v", *changes, want)
+	}
+
+	for i := range want {
+		if (*changes)[i] != want[i] {
+			t.Errorf("change %d = %v, want %v", i, (*changes)[i], want[i])
+		}
+	}
+}
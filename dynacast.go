@@ -0,0 +1,158 @@
+package meetup
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+const messageTypeSimulcastLayers = "simulcast_layers"
+
+type SimulcastLayerState struct {
+	RID     string `json:"rid"`
+	Enabled bool   `json:"enabled"`
+}
+
+type SimulcastLayersMessage struct {
+	TrackID string                `json:"track_id"`
+	Layers  []SimulcastLayerState `json:"layers"`
+}
+
+// dynacast pauses the simulcast layers of a published track that no subscriber
+// is claiming. Layers are enabled as soon as a claim needs them and disabled only
+// after they are unclaimed for the debounce duration, so a claim that flips
+// between two layers doesn't make the publisher restart an encoding.
+type dynacast struct {
+	mu          sync.RWMutex
+	track       *Track
+	debounce    time.Duration
+	enabled     map[string]bool
+	unclaimedAt map[string]time.Time
+	pending     bool
+}
+
+func newDynacast(track *Track, debounce time.Duration) *dynacast {
+	return &dynacast{
+		mu:          sync.RWMutex{},
+		track:       track,
+		debounce:    debounce,
+		enabled:     make(map[string]bool),
+		unclaimedAt: make(map[string]time.Time),
+	}
+}
+
+func (d *dynacast) loop() {
+	ctx, cancel := context.WithCancel(d.track.Context())
+	defer cancel()
+
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.update()
+		}
+	}
+}
+
+func (d *dynacast) claimedLayers() map[QualityLevel]bool {
+	claimed := make(map[QualityLevel]bool)
+
+	for _, ct := range d.track.ClientTracks() {
+		if ct.Context().Err() != nil {
+			continue
+		}
+
+		if layer := simulcastLayer(ct.Quality()); layer != QualityNone {
+			claimed[layer] = true
+		}
+	}
+
+	return claimed
+}
+
+func (d *dynacast) update() {
+	claimed := d.claimedLayers()
+	now := time.Now()
+	changed := false
+
+	d.mu.Lock()
+
+	for rid := range d.track.RemoteTracks() {
+		enabled, known := d.enabled[rid]
+		if !known {
+			// the publisher starts with every layer enabled
+			enabled = true
+			d.enabled[rid] = true
+		}
+
+		if claimed[ridToQuality(rid)] {
+			delete(d.unclaimedAt, rid)
+
+			if !enabled {
+				d.enabled[rid] = true
+				changed = true
+			}
+
+			continue
+		}
+
+		if !enabled {
+			continue
+		}
+
+		since, ok := d.unclaimedAt[rid]
+		if !ok {
+			d.unclaimedAt[rid] = now
+			continue
+		}
+
+		if now.Sub(since) >= d.debounce {
+			d.enabled[rid] = false
+			changed = true
+		}
+	}
+
+	if !changed && !d.pending {
+		d.mu.Unlock()
+		return
+	}
+
+	msg := SimulcastLayersMessage{
+		TrackID: d.track.ID(),
+		Layers:  make([]SimulcastLayerState, 0, len(d.enabled)),
+	}
+
+	for rid, enabled := range d.enabled {
+		msg.Layers = append(msg.Layers, SimulcastLayerState{RID: rid, Enabled: enabled})
+	}
+
+	sort.Slice(msg.Layers, func(i, j int) bool {
+		return ridToQuality(msg.Layers[i].RID) > ridToQuality(msg.Layers[j].RID)
+	})
+
+	d.mu.Unlock()
+
+	client := d.track.Client()
+	err := client.sendInternalMessage(msg)
+	if err != nil {
+		client.log.Debugf("dynacast: failed to send layers of track %s: %s", d.track.ID(), err.Error())
+	}
+
+	d.mu.Lock()
+	d.pending = err != nil
+	d.mu.Unlock()
+}
+
+func (d *dynacast) IsLayerEnabled(rid string) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	enabled, ok := d.enabled[rid]
+
+	return !ok || enabled
+}
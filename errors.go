@@ -3,11 +3,16 @@ package meetup
 import "errors"
 
 var (
-	ErrClientNotFound = errors.New("client not found")
-	ErrClientExists   = errors.New("client already exists")
+	ErrClientNotFound   = errors.New("client not found")
+	ErrClientExists     = errors.New("client already exists")
+	ErrClientNotWaiting = errors.New("client is not waiting in the lobby")
+	ErrClientBanned     = errors.New("client is banned from the room")
 
+	ErrRoomExists     = errors.New("room already exists")
+	ErrRoomNotFound   = errors.New("room not found")
 	ErrRoomIsClosed   = errors.New("room is closed")
 	ErrRoomIsNotEmpty = errors.New("room is not empty")
+	ErrRoomIsFull     = errors.New("room is full")
 	ErrDecodingData   = errors.New("error decoding data")
 	ErrEncodingData   = errors.New("error encoding data")
 	ErrNotFound       = errors.New("not found")
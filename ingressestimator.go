@@ -0,0 +1,254 @@
+package meetup
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gautam24s/meetup/pkg/interceptors/twccmonitor"
+	"github.com/pion/webrtc/v4"
+)
+
+const (
+	QualityLimitationReasonNone      = "none"
+	QualityLimitationReasonBandwidth = "bandwidth"
+	QualityLimitationReasonCPU       = "cpu"
+
+	ingressHighLossThreshold = 0.1
+	ingressLowLossThreshold  = 0.02
+	ingressIncreaseRate      = 1.05
+	ingressMinBandwith       = 50_000
+)
+
+type IngressBandwithMessage struct {
+	EstimatedBandwith       uint32  `json:"estimated_bandwith"`
+	ReceiveBitrate          uint32  `json:"receive_bitrate"`
+	PacketLoss              float64 `json:"packet_loss"`
+	QualityLimitationReason string  `json:"quality_limitation_reason"`
+}
+
+// ingressEstimator estimates the uplink of a publisher with a loss based controller
+// similar to the one in GCC. Loss is taken from the TWCC feedback we send to the
+// publisher, or from the inbound RTP stats when the publisher doesn't use TWCC.
+type ingressEstimator struct {
+	mu            sync.Mutex
+	client        *Client
+	twcc          *twccmonitor.Interceptor
+	lastReceived  uint64
+	lastLost      uint64
+	lastStats     map[uint32][2]uint64
+	seenLayers    map[string]bool
+	estimate      uint32
+	lastSent      uint32
+	lastSentSince time.Time
+}
+
+func newIngressEstimator(client *Client, twcc *twccmonitor.Interceptor) *ingressEstimator {
+	return &ingressEstimator{
+		mu:         sync.Mutex{},
+		client:     client,
+		twcc:       twcc,
+		lastStats:  make(map[uint32][2]uint64),
+		seenLayers: make(map[string]bool),
+	}
+}
+
+func (e *ingressEstimator) loop() {
+	ctx, cancel := context.WithCancel(e.client.Context())
+	defer cancel()
+
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			e.update()
+		}
+	}
+}
+
+func (e *ingressEstimator) update() {
+	tracks := e.client.publishedTracks.GetTracks()
+	if len(tracks) == 0 {
+		return
+	}
+
+	e.mu.Lock()
+	receiveBitrate, droppedLayers := e.receiveBitrate(tracks)
+	loss := e.lossFraction(tracks)
+	estimate, reason := e.apply(receiveBitrate, loss, droppedLayers)
+	e.mu.Unlock()
+
+	e.client.ingressBandwith.Store(estimate)
+	previousReason := e.client.ingressQualityLimitationReason.Swap(reason)
+
+	if previousReason != reason || e.isSignificantChange(estimate) {
+		e.notify(IngressBandwithMessage{
+			EstimatedBandwith:       estimate,
+			ReceiveBitrate:          receiveBitrate,
+			PacketLoss:              loss,
+			QualityLimitationReason: reason,
+		})
+	}
+}
+
+// apply moves the estimate with the loss of the last interval and returns it
+// with the reason the publisher quality is limited. Above 10% loss the estimate
+// drops below the received bitrate, under 2% it grows 5% per interval up to
+// twice the received bitrate, in between it holds. The caller holds e.mu.
+func (e *ingressEstimator) apply(receiveBitrate uint32, loss float64, droppedLayers int) (uint32, string) {
+	switch {
+	case loss > ingressHighLossThreshold:
+		e.estimate = uint32(float64(receiveBitrate) * (1 - 0.5*loss))
+	case loss < ingressLowLossThreshold:
+		e.estimate = max(uint32(float64(e.estimate)*ingressIncreaseRate), receiveBitrate)
+		e.estimate = min(e.estimate, receiveBitrate*2)
+	}
+
+	e.estimate = max(e.estimate, ingressMinBandwith)
+
+	reason := QualityLimitationReasonNone
+
+	switch {
+	case loss > ingressHighLossThreshold:
+		reason = QualityLimitationReasonBandwidth
+	case droppedLayers > 0 && loss > ingressLowLossThreshold:
+		reason = QualityLimitationReasonBandwidth
+	case droppedLayers > 0:
+		// the publisher stopped sending a layer although its link is clean, so the
+		// encoder is the one dropping it
+		reason = QualityLimitationReasonCPU
+	}
+
+	return e.estimate, reason
+}
+
+// receiveBitrate sums the bitrate of the tracks the publisher is sending and
+// counts the simulcast layers it stopped sending. Muted, paused or inactive
+// tracks are skipped and forget their layers, as the publisher isn't expected
+// to send them. The caller holds e.mu.
+func (e *ingressEstimator) receiveBitrate(tracks []ITrack) (uint32, int) {
+	receiveBitrate := uint32(0)
+	droppedLayers := 0
+
+	for _, track := range tracks {
+		t, ok := track.(*Track)
+		if !ok {
+			continue
+		}
+
+		paused := t.isPaused()
+
+		for rid, rt := range t.RemoteTracks() {
+			key := t.ID() + ":" + rid
+
+			if paused {
+				delete(e.seenLayers, key)
+				continue
+			}
+
+			bitrate := rt.ReceiveBitrate()
+			receiveBitrate += bitrate
+
+			if !t.IsSimulcast() || t.Kind() != webrtc.RTPCodecTypeVideo {
+				continue
+			}
+
+			if !t.IsLayerEnabled(rid) {
+				// paused by dynacast, not by the publisher
+				delete(e.seenLayers, key)
+				continue
+			}
+
+			if bitrate > 0 {
+				e.seenLayers[key] = true
+			} else if e.seenLayers[key] {
+				droppedLayers++
+			}
+		}
+	}
+
+	return receiveBitrate, droppedLayers
+}
+
+func (e *ingressEstimator) lossFraction(tracks []ITrack) float64 {
+	if e.twcc != nil {
+		received, lost := e.twcc.Counters()
+		deltaReceived := received - e.lastReceived
+		deltaLost := lost - e.lastLost
+		e.lastReceived, e.lastLost = received, lost
+
+		if deltaReceived+deltaLost > 0 {
+			return float64(deltaLost) / float64(deltaReceived+deltaLost)
+		}
+	}
+
+	if e.client.statsGetter == nil {
+		return 0
+	}
+
+	var deltaReceived, deltaLost uint64
+
+	for _, track := range tracks {
+		t, ok := track.(*Track)
+		if !ok {
+			continue
+		}
+
+		for _, rt := range t.RemoteTracks() {
+			ssrc := uint32(rt.Track().SSRC())
+
+			s := e.client.statsGetter.Get(ssrc)
+			if s == nil {
+				continue
+			}
+
+			received := s.InboundRTPStreamStats.PacketsReceived
+			lost := uint64(max(s.InboundRTPStreamStats.PacketsLost, 0))
+			last := e.lastStats[ssrc]
+
+			if received >= last[0] && lost >= last[1] {
+				deltaReceived += received - last[0]
+				deltaLost += lost - last[1]
+			}
+
+			e.lastStats[ssrc] = [2]uint64{received, lost}
+		}
+	}
+
+	if deltaReceived+deltaLost == 0 {
+		return 0
+	}
+
+	return float64(deltaLost) / float64(deltaReceived+deltaLost)
+}
+
+func (e *ingressEstimator) isSignificantChange(estimate uint32) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.lastSent == 0 {
+		return true
+	}
+
+	diff := float64(estimate) - float64(e.lastSent)
+	if diff < 0 {
+		diff = -diff
+	}
+
+	return diff/float64(e.lastSent) > 0.1 || time.Since(e.lastSentSince) > 10*time.Second
+}
+
+func (e *ingressEstimator) notify(msg IngressBandwithMessage) {
+	e.mu.Lock()
+	e.lastSent = msg.EstimatedBandwith
+	e.lastSentSince = time.Now()
+	e.mu.Unlock()
+
+	if err := e.client.sendInternalMessage(msg); err != nil {
+		e.client.log.Debugf("client: failed to send ingress bandwidth to %s: %s", e.client.ID(), err.Error())
+	}
+}
@@ -0,0 +1,127 @@
+package meetup
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+func TestIngressEstimatorApply(t *testing.T) {
+	testCases := []struct {
+		name           string
+		estimate       uint32
+		receiveBitrate uint32
+		loss           float64
+		droppedLayers  int
+		wantEstimate   uint32
+		wantReason     string
+	}{
+		{"high loss drops below the received bitrate", 2_000_000, 1_000_000, 0.2, 0, 900_000, QualityLimitationReasonBandwidth},
+		{"loss at the high threshold holds", 700_000, 1_000_000, 0.1, 0, 700_000, QualityLimitationReasonNone},
+		{"mid loss holds", 700_000, 1_000_000, 0.05, 0, 700_000, QualityLimitationReasonNone},
+		{"loss at the low threshold holds", 700_000, 1_000_000, 0.02, 0, 700_000, QualityLimitationReasonNone},
+		{"low loss starts from the received bitrate", 0, 1_000_000, 0, 0, 1_000_000, QualityLimitationReasonNone},
+		{"low loss grows by 5%", 1_000_000, 1_000_000, 0.01, 0, 1_050_000, QualityLimitationReasonNone},
+		{"low loss is capped at twice the received bitrate", 1_950_000, 1_000_000, 0, 0, 2_000_000, QualityLimitationReasonNone},
+		{"estimate never goes under the minimum", 0, 0, 0.5, 0, ingressMinBandwith, QualityLimitationReasonBandwidth},
+		{"dropped layer with loss is bandwidth", 700_000, 1_000_000, 0.05, 1, 700_000, QualityLimitationReasonBandwidth},
+		{"dropped layer on a clean link is cpu", 1_000_000, 1_000_000, 0, 1, 1_050_000, QualityLimitationReasonCPU},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := &ingressEstimator{estimate: tc.estimate}
+
+			estimate, reason := e.apply(tc.receiveBitrate, tc.loss, tc.droppedLayers)
+
+			if estimate != tc.wantEstimate {
+				t.Errorf("estimate = %d, want %d", estimate, tc.wantEstimate)
+			}
+
+			if reason != tc.wantReason {
+				t.Errorf("reason = %s, want %s", reason, tc.wantReason)
+			}
+		})
+	}
+}
+
+func TestIngressEstimatorIsSignificantChange(t *testing.T) {
+	testCases := []struct {
+		name     string
+		lastSent uint32
+		sentAgo  time.Duration
+		estimate uint32
+		want     bool
+	}{
+		{"nothing sent yet", 0, 0, 1_000_000, true},
+		{"same estimate", 1_000_000, time.Second, 1_000_000, false},
+		{"5% up", 1_000_000, time.Second, 1_050_000, false},
+		{"10% up is not above the threshold", 1_000_000, time.Second, 1_100_000, false},
+		{"20% up", 1_000_000, time.Second, 1_200_000, true},
+		{"15% down", 1_000_000, time.Second, 850_000, true},
+		{"same estimate after 10s", 1_000_000, 11 * time.Second, 1_000_000, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := &ingressEstimator{
+				lastSent:      tc.lastSent,
+				lastSentSince: time.Now().Add(-tc.sentAgo),
+			}
+
+			if got := e.isSignificantChange(tc.estimate); got != tc.want {
+				t.Errorf("isSignificantChange(%d) = %v, want %v", tc.estimate, got, tc.want)
+			}
+		})
+	}
+}
+
+func newTestSimulcastTrack(id string, bitrates map[string]uint32) *Track {
+	remoteTracks := make(map[string]*remoteTrack, len(bitrates))
+
+	for rid, bitrate := range bitrates {
+		rt := &remoteTrack{bitrate: &atomic.Uint32{}}
+		rt.bitrate.Store(bitrate)
+		remoteTracks[rid] = rt
+	}
+
+	return &Track{id: id, kind: webrtc.RTPCodecTypeVideo, isSimulcast: true, remoteTracks: remoteTracks}
+}
+
+func TestIngressEstimatorReceiveBitrate(t *testing.T) {
+	e := newIngressEstimator(nil, nil)
+
+	track := newTestSimulcastTrack("video", map[string]uint32{"low": 100_000, "high": 1_000_000})
+
+	if bitrate, dropped := e.receiveBitrate([]ITrack{track}); bitrate != 1_100_000 || dropped != 0 {
+		t.Fatalf("receive bitrate = %d, %d, want 1100000, 0", bitrate, dropped)
+	}
+
+	track.remoteTracks["high"].bitrate.Store(0)
+
+	if bitrate, dropped := e.receiveBitrate([]ITrack{track}); bitrate != 100_000 || dropped != 1 {
+		t.Fatalf("receive bitrate = %d, %d, want 100000 with the high layer dropped", bitrate, dropped)
+	}
+
+	// a muted track isn't a dropped layer and forgets the layers it had
+	track.muteReasons = muteReasonPublisher
+	track.remoteTracks["low"].bitrate.Store(0)
+
+	if bitrate, dropped := e.receiveBitrate([]ITrack{track}); bitrate != 0 || dropped != 0 {
+		t.Errorf("receive bitrate of a muted track = %d, %d, want 0, 0", bitrate, dropped)
+	}
+
+	if len(e.seenLayers) != 0 {
+		t.Errorf("seen layers = %v after a mute, want none", e.seenLayers)
+	}
+
+	// after the unmute, layers count as dropped only once they were seen again
+	track.muteReasons = 0
+	track.remoteTracks["low"].bitrate.Store(100_000)
+
+	if _, dropped := e.receiveBitrate([]ITrack{track}); dropped != 0 {
+		t.Errorf("dropped layers after the unmute = %d, want 0", dropped)
+	}
+}
@@ -0,0 +1,416 @@
+package meetup
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// InternalProtocolVersion is the version of the internal data channel protocol
+// sent in every message. Messages without a version come from clients written
+// before it and are read as version 1.
+const InternalProtocolVersion = 1
+
+const (
+	messageTypeQualityChanged       = "quality_changed"
+	messageTypeRequestRenegotiation = "request_renegotiation"
+
+	internalMessageQueueSize = 256
+
+	// how long a client about to be stopped is given to receive its last message
+	internalMessageDrainTimeout  = 500 * time.Millisecond
+	internalMessageDrainInterval = 10 * time.Millisecond
+)
+
+var (
+	ErrUnknownMessageType = errors.New("client: error unknown internal message type")
+	ErrUnsupportedVersion = errors.New("client: error unsupported internal protocol version")
+)
+
+// InternalMessage is a message of the internal data channel, the type is sent
+// next to the JSON of the message:
+//
+//	{"v": 1, "type": "video_size", "data": {"track_id": "...", "width": 640, "height": 360}}
+type InternalMessage interface {
+	InternalMessageType() string
+}
+
+type internalDataMessage struct {
+	Version int             `json:"v,omitempty"`
+	Type    string          `json:"type"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// internalMessageTypes creates an empty message for every type the decoder
+// knows, the messages sharing a shape keep their type in a field.
+var internalMessageTypes = map[string]func() InternalMessage{
+	messageTypeVideoSize:            func() InternalMessage { return &VideoSizeMessage{} },
+	messageTypeStats:                func() InternalMessage { return &StatsMessage{} },
+	messageTypeVADStarted:           func() InternalMessage { return &SpeakerMessage{Type: messageTypeVADStarted} },
+	messageTypeVADEnded:             func() InternalMessage { return &SpeakerMessage{Type: messageTypeVADEnded} },
+	messageTypeIngressBandwith:      func() InternalMessage { return &IngressBandwithMessage{} },
+	messageTypePauseTrack:           func() InternalMessage { return &TrackControlMessage{Type: messageTypePauseTrack} },
+	messageTypeResumeTrack:          func() InternalMessage { return &TrackControlMessage{Type: messageTypeResumeTrack} },
+	messageTypePinTrack:             func() InternalMessage { return &TrackControlMessage{Type: messageTypePinTrack} },
+	messageTypeUnpinTrack:           func() InternalMessage { return &TrackControlMessage{Type: messageTypeUnpinTrack} },
+	messageTypeMuteTrack:            func() InternalMessage { return &TrackControlMessage{Type: messageTypeMuteTrack} },
+	messageTypeUnmuteTrack:          func() InternalMessage { return &TrackControlMessage{Type: messageTypeUnmuteTrack} },
+	messageTypeTracksAvailable:      func() InternalMessage { return &TracksAvailableMessage{} },
+	messageTypeTrackMuted:           func() InternalMessage { return &TrackMutedMessage{} },
+	messageTypeUnpublished:          func() InternalMessage { return &TrackUnpublishedMessage{} },
+	messageTypeTrackSource:          func() InternalMessage { return &TrackSourceMessage{} },
+	messageTypeSimulcastLayers:      func() InternalMessage { return &SimulcastLayersMessage{} },
+	messageTypeQualityChanged:       func() InternalMessage { return &QualityChangedMessage{} },
+	messageTypeRequestRenegotiation: func() InternalMessage { return &RequestRenegotiationMessage{} },
+	messageTypePermissionsChanged:   func() InternalMessage { return &PermissionsChangedMessage{} },
+	messageTypeLobbyAdmitted:        func() InternalMessage { return &LobbyAdmittedMessage{} },
+	messageTypeLobbyRejected:        func() InternalMessage { return &LobbyRejectedMessage{} },
+	messageTypeClientKicked:         func() InternalMessage { return &ClientKickedMessage{} },
+	messageTypeMetadataChanged:      func() InternalMessage { return &MetadataChangedMessage{} },
+	messageTypeMetadataSnapshot:     func() InternalMessage { return &MetadataSnapshotMessage{} },
+	messageTypeMetadataConflict:     func() InternalMessage { return &MetadataConflictMessage{} },
+	messageTypeSetMetadata:          func() InternalMessage { return &SetMetadataMessage{Type: messageTypeSetMetadata} },
+	messageTypeDeleteMetadata:       func() InternalMessage { return &SetMetadataMessage{Type: messageTypeDeleteMetadata} },
+}
+
+func EncodeInternalMessage(msg InternalMessage) ([]byte, error) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return nil, ErrEncodingData
+	}
+
+	payload, err := json.Marshal(internalDataMessage{
+		Version: InternalProtocolVersion,
+		Type:    msg.InternalMessageType(),
+		Data:    data,
+	})
+	if err != nil {
+		return nil, ErrEncodingData
+	}
+
+	return payload, nil
+}
+
+// DecodeInternalMessage returns a pointer to the message of the payload type,
+// such as *VideoSizeMessage.
+func DecodeInternalMessage(payload []byte) (InternalMessage, error) {
+	envelope := internalDataMessage{}
+	if err := json.Unmarshal(payload, &envelope); err != nil {
+		return nil, ErrDecodingData
+	}
+
+	if envelope.Version > InternalProtocolVersion {
+		return nil, ErrUnsupportedVersion
+	}
+
+	newMessage, ok := internalMessageTypes[envelope.Type]
+	if !ok {
+		return nil, ErrUnknownMessageType
+	}
+
+	msg := newMessage()
+
+	if len(envelope.Data) > 0 && !bytes.Equal(envelope.Data, []byte("null")) {
+		if err := json.Unmarshal(envelope.Data, msg); err != nil {
+			return nil, ErrDecodingData
+		}
+	}
+
+	return msg, nil
+}
+
+// StatsMessage is sent to the client every ClientOptions.StatsInterval.
+type StatsMessage struct {
+	EstimatedBandwith       uint32 `json:"estimated_bandwith"`
+	SentBitrate             uint32 `json:"sent_bitrate"`
+	ClaimedBitrate          uint32 `json:"claimed_bitrate"`
+	IngressBandwith         uint32 `json:"ingress_bandwith"`
+	QualityLimitationReason string `json:"quality_limitation_reason"`
+	Time                    int64  `json:"time"`
+}
+
+func (StatsMessage) InternalMessageType() string {
+	return messageTypeStats
+}
+
+// QualityChangedMessage tells the client the bandwidth changed the quality of a
+// track it is subscribed to.
+type QualityChangedMessage struct {
+	TrackID string       `json:"track_id"`
+	Quality QualityLevel `json:"quality"`
+}
+
+func (QualityChangedMessage) InternalMessageType() string {
+	return messageTypeQualityChanged
+}
+
+// RequestRenegotiationMessage asks the SFU for a new offer, for a client that
+// changed its transceivers or lost the last one.
+type RequestRenegotiationMessage struct{}
+
+func (RequestRenegotiationMessage) InternalMessageType() string {
+	return messageTypeRequestRenegotiation
+}
+
+type VideoSizeMessage struct {
+	TrackID string `json:"track_id"`
+	Width   uint32 `json:"width"`
+	Height  uint32 `json:"height"`
+}
+
+func (VideoSizeMessage) InternalMessageType() string {
+	return messageTypeVideoSize
+}
+
+// TrackControlMessage pauses, resumes, pins, unpins, mutes or unmutes a track
+// depending on its type.
+type TrackControlMessage struct {
+	Type    string `json:"-"`
+	TrackID string `json:"track_id"`
+}
+
+func (m TrackControlMessage) InternalMessageType() string {
+	return m.Type
+}
+
+type TrackSourceMessage struct {
+	TrackID string    `json:"track_id"`
+	Source  TrackType `json:"source"`
+}
+
+func (TrackSourceMessage) InternalMessageType() string {
+	return messageTypeTrackSource
+}
+
+// TracksAvailableMessage lists the tracks a client without auto subscribe can
+// subscribe to.
+type TracksAvailableMessage []TrackInfo
+
+func (TracksAvailableMessage) InternalMessageType() string {
+	return messageTypeTracksAvailable
+}
+
+// SpeakerMessage tells a client started or stopped being the dominant speaker.
+type SpeakerMessage struct {
+	Type     string `json:"-"`
+	ClientID string `json:"client_id"`
+}
+
+func (m SpeakerMessage) InternalMessageType() string {
+	return m.Type
+}
+
+func (TrackMutedMessage) InternalMessageType() string {
+	return messageTypeTrackMuted
+}
+
+func (TrackUnpublishedMessage) InternalMessageType() string {
+	return messageTypeUnpublished
+}
+
+func (SimulcastLayersMessage) InternalMessageType() string {
+	return messageTypeSimulcastLayers
+}
+
+func (IngressBandwithMessage) InternalMessageType() string {
+	return messageTypeIngressBandwith
+}
+
+func (PermissionsChangedMessage) InternalMessageType() string {
+	return messageTypePermissionsChanged
+}
+
+type LobbyAdmittedMessage struct{}
+
+func (LobbyAdmittedMessage) InternalMessageType() string {
+	return messageTypeLobbyAdmitted
+}
+
+func (LobbyRejectedMessage) InternalMessageType() string {
+	return messageTypeLobbyRejected
+}
+
+func (ClientKickedMessage) InternalMessageType() string {
+	return messageTypeClientKicked
+}
+
+func (MetadataChangedMessage) InternalMessageType() string {
+	return messageTypeMetadataChanged
+}
+
+func (MetadataSnapshotMessage) InternalMessageType() string {
+	return messageTypeMetadataSnapshot
+}
+
+func (MetadataConflictMessage) InternalMessageType() string {
+	return messageTypeMetadataConflict
+}
+
+func (m SetMetadataMessage) InternalMessageType() string {
+	return m.Type
+}
+
+// internalMessageSender is the internal data channel as seen by the queue.
+type internalMessageSender interface {
+	SendText(string) error
+	ReadyState() webrtc.DataChannelState
+	BufferedAmount() uint64
+}
+
+// sendInternalMessage queues the message while the internal data channel is not
+// open, the queue is sent in order once it opens and drops the oldest messages
+// when it is full.
+func (c *Client) sendInternalMessage(msg InternalMessage) error {
+	if c.State() == ClientStateEnded {
+		return ErrClientStopped
+	}
+
+	payload, err := EncodeInternalMessage(msg)
+	if err != nil {
+		return err
+	}
+
+	c.muInternalMessages.Lock()
+	defer c.muInternalMessages.Unlock()
+
+	c.mu.Lock()
+	dc := c.internalDataChannel
+	c.mu.Unlock()
+
+	if dc == nil || dc.ReadyState() != webrtc.DataChannelStateOpen {
+		c.queueInternalMessage(payload)
+		return nil
+	}
+
+	// the queue left by a failed flush goes first to keep the order
+	if len(c.pendingInternalMessages) > 0 {
+		c.queueInternalMessage(payload)
+		c.sendPendingInternalMessages(dc)
+
+		return nil
+	}
+
+	return dc.SendText(string(payload))
+}
+
+// queueInternalMessage adds a message to the queue, the caller holds
+// muInternalMessages.
+func (c *Client) queueInternalMessage(payload []byte) {
+	if len(c.pendingInternalMessages) == internalMessageQueueSize {
+		c.log.Debugf("client: internal message queue of %s is full, dropping the oldest message", c.ID())
+		c.pendingInternalMessages = append(c.pendingInternalMessages[:0], c.pendingInternalMessages[1:]...)
+	}
+
+	c.pendingInternalMessages = append(c.pendingInternalMessages, payload)
+}
+
+// flushInternalMessages sends the queued messages once the internal data channel
+// is open.
+func (c *Client) flushInternalMessages() {
+	c.muInternalMessages.Lock()
+	defer c.muInternalMessages.Unlock()
+
+	c.mu.Lock()
+	dc := c.internalDataChannel
+	c.mu.Unlock()
+
+	if dc == nil || dc.ReadyState() != webrtc.DataChannelStateOpen {
+		return
+	}
+
+	c.sendPendingInternalMessages(dc)
+}
+
+// sendPendingInternalMessages sends the queue in order, the caller holds
+// muInternalMessages. A message that fails on an open channel is dropped so it
+// can't hold back the others, the queue is kept when the channel closed.
+func (c *Client) sendPendingInternalMessages(dc internalMessageSender) {
+	for len(c.pendingInternalMessages) > 0 {
+		if err := dc.SendText(string(c.pendingInternalMessages[0])); err != nil {
+			if dc.ReadyState() != webrtc.DataChannelStateOpen {
+				c.log.Debugf("client: failed to send queued internal message to %s: %s", c.ID(), err.Error())
+				return
+			}
+
+			c.log.Debugf("client: dropping queued internal message to %s: %s", c.ID(), err.Error())
+		}
+
+		c.pendingInternalMessages = c.pendingInternalMessages[1:]
+	}
+
+	c.pendingInternalMessages = nil
+}
+
+// sendLastInternalMessage sends the message to a client about to be stopped and
+// waits for the internal data channel to send it, so the client learns why it is
+// removed before its connection closes.
+func (c *Client) sendLastInternalMessage(msg InternalMessage) {
+	if err := c.sendInternalMessage(msg); err != nil {
+		c.log.Debugf("client: failed to send %s to %s: %s", msg.InternalMessageType(), c.ID(), err.Error())
+		return
+	}
+
+	c.mu.Lock()
+	dc := c.internalDataChannel
+	c.mu.Unlock()
+
+	if dc == nil {
+		return
+	}
+
+	c.waitInternalMessagesSent(dc, internalMessageDrainTimeout)
+}
+
+// waitInternalMessagesSent waits until the queue and the buffer of the channel
+// are empty, and reports false when the channel closed or the timeout passed
+// first.
+func (c *Client) waitInternalMessagesSent(dc internalMessageSender, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		c.muInternalMessages.Lock()
+		pending := len(c.pendingInternalMessages)
+		c.muInternalMessages.Unlock()
+
+		switch state := dc.ReadyState(); {
+		case state == webrtc.DataChannelStateClosing || state == webrtc.DataChannelStateClosed:
+			return false
+		case state == webrtc.DataChannelStateOpen && pending == 0 && dc.BufferedAmount() == 0:
+			return true
+		case time.Now().After(deadline):
+			return false
+		}
+
+		time.Sleep(internalMessageDrainInterval)
+	}
+}
+
+func (c *Client) statsLoop() {
+	ctx, cancel := context.WithCancel(c.Context())
+	defer cancel()
+
+	ticker := time.NewTicker(c.options.StatsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.sendInternalMessage(StatsMessage{
+				EstimatedBandwith:       c.GetEstimatedBandwith(),
+				SentBitrate:             c.bitrateController.totalSentBitrates(),
+				ClaimedBitrate:          c.bitrateController.totalClaimedBitrates(),
+				IngressBandwith:         c.IngressBandwith(),
+				QualityLimitationReason: c.IngressQualityLimitationReason(),
+				Time:                    time.Now().UnixMilli(),
+			}); err != nil {
+				c.log.Debugf("client: failed to send stats to %s: %s", c.ID(), err.Error())
+			}
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package meetup
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/pion/webrtc/v4"
+)
+
+func TestInternalMessageRoundTrip(t *testing.T) {
+	version := uint64(3)
+
+	messages := []InternalMessage{
+		&VideoSizeMessage{TrackID: "track", Width: 640, Height: 360},
+		&StatsMessage{EstimatedBandwith: 1_000_000, SentBitrate: 500_000, QualityLimitationReason: QualityLimitationReasonCPU, Time: 42},
+		&SpeakerMessage{Type: messageTypeVADStarted, ClientID: "alice"},
+		&TrackControlMessage{Type: messageTypePinTrack, TrackID: "track"},
+		&TrackSourceMessage{TrackID: "track", Source: TrackTypeScreen},
+		&TracksAvailableMessage{{ClientID: "alice", TrackID: "track", Kind: "video"}},
+		&QualityChangedMessage{TrackID: "track", Quality: QualityMid},
+		&RequestRenegotiationMessage{},
+		&LobbyAdmittedMessage{},
+		&MetadataChangedMessage{Scope: MetadataScopeRoom, MetadataChange: MetadataChange{Revision: 2, Key: "topic", Value: "news", Version: 1}},
+		&MetadataConflictMessage{Scope: MetadataScopeClient, Key: "hand", Version: 4},
+		&SetMetadataMessage{Type: messageTypeSetMetadata, Scope: MetadataScopeClient, Key: "hand", Value: json.RawMessage(`true`), ExpectedVersion: &version},
+	}
+
+	for _, msg := range messages {
+		t.Run(msg.InternalMessageType(), func(t *testing.T) {
+			payload, err := EncodeInternalMessage(msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			decoded, err := DecodeInternalMessage(payload)
+			if err != nil {
+				t.Fatalf("DecodeInternalMessage(%s) error: %s", payload, err)
+			}
+
+			if decoded.InternalMessageType() != msg.InternalMessageType() {
+				t.Errorf("type = %s, want %s", decoded.InternalMessageType(), msg.InternalMessageType())
+			}
+
+			if !reflect.DeepEqual(decoded, msg) {
+				t.Errorf("decoded = %#v, want %#v", decoded, msg)
+			}
+		})
+	}
+}
+
+func TestInternalMessageTypesRoundTrip(t *testing.T) {
+	for messageType, newMessage := range internalMessageTypes {
+		t.Run(messageType, func(t *testing.T) {
+			msg := newMessage()
+
+			if msg.InternalMessageType() != messageType {
+				t.Fatalf("type = %s, want %s", msg.InternalMessageType(), messageType)
+			}
+
+			payload, err := EncodeInternalMessage(msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			decoded, err := DecodeInternalMessage(payload)
+			if err != nil {
+				t.Fatalf("DecodeInternalMessage(%s) error: %s", payload, err)
+			}
+
+			if decoded.InternalMessageType() != messageType || reflect.TypeOf(decoded) != reflect.TypeOf(msg) {
+				t.Errorf("decoded %T of type %s, want %T of type %s", decoded, decoded.InternalMessageType(), msg, messageType)
+			}
+		})
+	}
+}
+
+func TestDecodeInternalMessage(t *testing.T) {
+	testCases := []struct {
+		name    string
+		payload string
+		wantErr error
+	}{
+		{"current version", `{"v":1,"type":"video_size","data":{"track_id":"track"}}`, nil},
+		{"without version", `{"type":"video_size","data":{"track_id":"track"}}`, nil},
+		{"without data", `{"v":1,"type":"request_renegotiation"}`, nil},
+		{"newer version", `{"v":2,"type":"video_size","data":{"track_id":"track"}}`, ErrUnsupportedVersion},
+		{"unknown type", `{"v":1,"type":"unknown","data":{}}`, ErrUnknownMessageType},
+		{"invalid envelope", `{"v":1,`, ErrDecodingData},
+		{"invalid data", `{"v":1,"type":"video_size","data":{"width":"wide"}}`, ErrDecodingData},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := DecodeInternalMessage([]byte(tc.payload))
+			if !errors.Is(err, tc.wantErr) {
+				t.Errorf("DecodeInternalMessage(%s) error = %v, want %v", tc.payload, err, tc.wantErr)
+			}
+		})
+	}
+}
+
+type testInternalMessageSender struct {
+	state    webrtc.DataChannelState
+	failAt   int
+	sent     []string
+	buffered atomic.Uint64
+}
+
+func (s *testInternalMessageSender) SendText(text string) error {
+	if len(s.sent) == s.failAt || s.state != webrtc.DataChannelStateOpen {
+		s.failAt = -1
+		return errors.New("send failed")
+	}
+
+	s.sent = append(s.sent, text)
+
+	return nil
+}
+
+func (s *testInternalMessageSender) ReadyState() webrtc.DataChannelState {
+	return s.state
+}
+
+func (s *testInternalMessageSender) BufferedAmount() uint64 {
+	return s.buffered.Load()
+}
+
+func newTestInternalMessageClient() *Client {
+	state := &atomic.Value{}
+	state.Store(ClientStateNew)
+
+	return &Client{
+		id:    "client",
+		state: state,
+		log:   logging.NewDefaultLoggerFactory().NewLogger("test"),
+	}
+}
+
+func sentStatsTimes(t *testing.T, sent []string) []int64 {
+	t.Helper()
+
+	times := make([]int64, 0, len(sent))
+
+	for _, text := range sent {
+		msg, err := DecodeInternalMessage([]byte(text))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		times = append(times, msg.(*StatsMessage).Time)
+	}
+
+	return times
+}
+
+func TestInternalMessageQueue(t *testing.T) {
+	c := newTestInternalMessageClient()
+
+	for i := 0; i < internalMessageQueueSize+2; i++ {
+		if err := c.sendInternalMessage(StatsMessage{Time: int64(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(c.pendingInternalMessages) != internalMessageQueueSize {
+		t.Fatalf("queue length = %d, want %d", len(c.pendingInternalMessages), internalMessageQueueSize)
+	}
+
+	sender := &testInternalMessageSender{state: webrtc.DataChannelStateOpen, failAt: -1}
+	c.sendPendingInternalMessages(sender)
+
+	times := sentStatsTimes(t, sender.sent)
+	if len(times) != internalMessageQueueSize {
+		t.Fatalf("sent %d messages, want %d", len(times), internalMessageQueueSize)
+	}
+
+	// the two oldest messages were dropped
+	for i, time := range times {
+		if time != int64(i+2) {
+			t.Fatalf("message %d has time %d, want %d", i, time, i+2)
+		}
+	}
+
+	if len(c.pendingInternalMessages) != 0 {
+		t.Errorf("queue length = %d after the flush, want 0", len(c.pendingInternalMessages))
+	}
+}
+
+func TestInternalMessageQueueSendFailure(t *testing.T) {
+	c := newTestInternalMessageClient()
+
+	for i := 0; i < 3; i++ {
+		if err := c.sendInternalMessage(StatsMessage{Time: int64(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a closed channel keeps the queue for the next open
+	closed := &testInternalMessageSender{state: webrtc.DataChannelStateClosed, failAt: -1}
+	c.sendPendingInternalMessages(closed)
+
+	if len(c.pendingInternalMessages) != 3 {
+		t.Fatalf("queue length = %d after a closed channel, want 3", len(c.pendingInternalMessages))
+	}
+
+	// a message failing on an open channel doesn't hold back the others
+	open := &testInternalMessageSender{state: webrtc.DataChannelStateOpen, failAt: 1}
+	c.sendPendingInternalMessages(open)
+
+	if times := sentStatsTimes(t, open.sent); !reflect.DeepEqual(times, []int64{0, 2}) {
+		t.Errorf("sent times = %v, want [0 2]", times)
+	}
+
+	if len(c.pendingInternalMessages) != 0 {
+		t.Errorf("queue length = %d after the flush, want 0", len(c.pendingInternalMessages))
+	}
+}
+
+func TestWaitInternalMessagesSent(t *testing.T) {
+	c := newTestInternalMessageClient()
+
+	open := &testInternalMessageSender{state: webrtc.DataChannelStateOpen, failAt: -1}
+	open.buffered.Store(1024)
+
+	go func() {
+		time.Sleep(5 * internalMessageDrainInterval)
+		open.buffered.Store(0)
+	}()
+
+	if !c.waitInternalMessagesSent(open, time.Second) {
+		t.Error("the wait should end once the buffer is sent")
+	}
+
+	// a channel that never sends its buffer is given up after the timeout
+	open.buffered.Store(1024)
+
+	start := time.Now()
+	if c.waitInternalMessagesSent(open, 50*time.Millisecond) || time.Since(start) > time.Second {
+		t.Error("the wait should time out")
+	}
+
+	// nothing can be sent on a closed channel
+	closed := &testInternalMessageSender{state: webrtc.DataChannelStateClosed, failAt: -1}
+
+	start = time.Now()
+	if c.waitInternalMessagesSent(closed, time.Second) || time.Since(start) > 500*time.Millisecond {
+		t.Error("the wait should end right away on a closed channel")
+	}
+
+	// a message queued until the channel opens is waited for
+	if err := c.sendInternalMessage(StatsMessage{}); err != nil {
+		t.Fatal(err)
+	}
+
+	connecting := &testInternalMessageSender{state: webrtc.DataChannelStateConnecting, failAt: -1}
+	if c.waitInternalMessagesSent(connecting, 50*time.Millisecond) {
+		t.Error("the queued message wasn't sent")
+	}
+}
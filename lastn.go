@@ -0,0 +1,148 @@
+package meetup
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// lastN pauses the subscribed video of every client except for the N publishers
+// that are pinned or spoke most recently. Screen shares are never paused.
+type lastN struct {
+	mu        sync.RWMutex
+	sfu       *SFU
+	n         int
+	lastSpoke map[string]time.Time
+}
+
+func newLastN(sfu *SFU, n int) *lastN {
+	return &lastN{
+		mu:        sync.RWMutex{},
+		sfu:       sfu,
+		n:         n,
+		lastSpoke: make(map[string]time.Time),
+	}
+}
+
+func (l *lastN) N() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.n
+}
+
+func (l *lastN) setN(n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.n = n
+}
+
+func (l *lastN) onVoiceActivity(clientID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.lastSpoke[clientID] = time.Now()
+}
+
+func (l *lastN) lastSpokeAt(clientID string) time.Time {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.lastSpoke[clientID]
+}
+
+func (l *lastN) removeClient(clientID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.lastSpoke, clientID)
+}
+
+func (l *lastN) loop() {
+	ctx, cancel := context.WithCancel(l.sfu.context)
+	defer cancel()
+
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, client := range l.sfu.GetClients() {
+				l.updateClient(client)
+			}
+		}
+	}
+}
+
+func (l *lastN) updateClient(client *Client) {
+	n := client.LastN()
+
+	videoTracks := make([]iClientTrack, 0)
+	for _, ct := range client.ClientTracks() {
+		if ct.Kind() == webrtc.RTPCodecTypeVideo {
+			videoTracks = append(videoTracks, ct)
+		}
+	}
+
+	if n <= 0 {
+		for _, ct := range videoTracks {
+			client.resumeClientTrack(ct, pauseReasonLastN)
+		}
+
+		return
+	}
+
+	pinnedPublishers := make(map[string]bool)
+	publishers := make([]string, 0)
+	seen := make(map[string]bool)
+
+	for _, ct := range videoTracks {
+		publisherID := ct.Track().ClientID()
+
+		if client.IsPinned(ct.ID()) {
+			pinnedPublishers[publisherID] = true
+		}
+
+		if !seen[publisherID] {
+			seen[publisherID] = true
+			publishers = append(publishers, publisherID)
+		}
+	}
+
+	l.mu.RLock()
+	sort.SliceStable(publishers, func(i, j int) bool {
+		a, b := publishers[i], publishers[j]
+		if pinnedPublishers[a] != pinnedPublishers[b] {
+			return pinnedPublishers[a]
+		}
+
+		if !l.lastSpoke[a].Equal(l.lastSpoke[b]) {
+			return l.lastSpoke[a].After(l.lastSpoke[b])
+		}
+
+		return a < b
+	})
+	l.mu.RUnlock()
+
+	selected := make(map[string]bool)
+	for i, publisherID := range publishers {
+		if i < n || pinnedPublishers[publisherID] {
+			selected[publisherID] = true
+		}
+	}
+
+	for _, ct := range videoTracks {
+		if selected[ct.Track().ClientID()] || ct.IsScreen() {
+			client.resumeClientTrack(ct, pauseReasonLastN)
+		} else {
+			client.pauseClientTrack(ct, pauseReasonLastN)
+		}
+	}
+}
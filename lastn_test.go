@@ -0,0 +1,114 @@
+package meetup
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// subscribeTestTrack subscribes the client to the track without a peer
+// connection.
+func subscribeTestTrack(c *Client, track *Track) *clientTrack {
+	ct := newTestClientTrack()
+	ct.id = track.ID()
+	ct.kind = track.Kind()
+	ct.context = context.Background()
+	ct.client = c
+	ct.track = track
+
+	c.clientTracks[ct.ID()] = ct
+
+	return ct
+}
+
+func TestLastNUpdateClient(t *testing.T) {
+	s := newTestSFU()
+	s.lastN = newLastN(s, 1)
+
+	subscriber := newTestRoomClient(s, "subscriber", ClientOptions{})
+
+	forwarded := make(map[string]*clientTrack)
+	for _, id := range []string{"alice", "bob", "carol"} {
+		publisher := newTestRoomClient(s, id, ClientOptions{})
+		forwarded[id] = subscribeTestTrack(subscriber, newTestClientPublishedTrack(publisher, id+"-video", webrtc.RTPCodecTypeVideo))
+	}
+
+	audio := subscribeTestTrack(subscriber, newTestClientPublishedTrack(s.clients.clients["alice"], "alice-audio", webrtc.RTPCodecTypeAudio))
+	screen := subscribeTestTrack(subscriber, newTestClientPublishedTrack(s.clients.clients["carol"], "carol-screen", webrtc.RTPCodecTypeVideo))
+	screen.track.(*Track).SetSourceType(TrackTypeScreen)
+
+	assertForwarded := func(t *testing.T, want ...string) {
+		t.Helper()
+
+		wanted := make(map[string]bool)
+		for _, id := range want {
+			wanted[id] = true
+		}
+
+		for id, ct := range forwarded {
+			if ct.IsPaused() == wanted[id] {
+				t.Errorf("video of %s paused = %v, want %v", id, ct.IsPaused(), !wanted[id])
+			}
+		}
+
+		if audio.IsPaused() || screen.IsPaused() {
+			t.Error("audio and screen shares should never be paused")
+		}
+	}
+
+	// without voice activity the publishers are ordered by ID
+	s.lastN.updateClient(subscriber)
+	assertForwarded(t, "alice")
+
+	s.lastN.onVoiceActivity("bob")
+	s.lastN.updateClient(subscriber)
+	assertForwarded(t, "bob")
+
+	s.lastN.lastSpoke["carol"] = time.Now().Add(time.Second)
+	s.lastN.updateClient(subscriber)
+	assertForwarded(t, "carol")
+
+	// pinned publishers come before the speakers and are forwarded even past N
+	if err := subscriber.PinTracks("alice-video", "bob-video"); err != nil {
+		t.Fatal(err)
+	}
+
+	s.lastN.updateClient(subscriber)
+	assertForwarded(t, "alice", "bob")
+
+	subscriber.UnpinTracks("bob-video")
+	s.lastN.updateClient(subscriber)
+	assertForwarded(t, "alice")
+
+	subscriber.UnpinTracks("alice-video")
+
+	// a client value overrides the room value, a negative value forwards everything
+	subscriber.SetLastN(2)
+	s.lastN.updateClient(subscriber)
+	assertForwarded(t, "bob", "carol")
+
+	subscriber.SetLastN(-1)
+	s.lastN.updateClient(subscriber)
+	assertForwarded(t, "alice", "bob", "carol")
+}
+
+func TestLastNKeepsSubscriberPause(t *testing.T) {
+	s := newTestSFU()
+	s.lastN = newLastN(s, 1)
+
+	subscriber := newTestRoomClient(s, "subscriber", ClientOptions{})
+	publisher := newTestRoomClient(s, "alice", ClientOptions{})
+	ct := subscribeTestTrack(subscriber, newTestClientPublishedTrack(publisher, "alice-video", webrtc.RTPCodecTypeVideo))
+
+	if err := subscriber.PauseTrack("alice-video"); err != nil {
+		t.Fatal(err)
+	}
+
+	s.lastN.updateClient(subscriber)
+
+	if !ct.IsPaused() {
+		t.Error("last-N shouldn't resume a track the subscriber paused")
+	}
+}
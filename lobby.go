@@ -0,0 +1,192 @@
+package meetup
+
+import (
+	"sync"
+)
+
+const (
+	messageTypeLobbyAdmitted = "lobby_admitted"
+	messageTypeLobbyRejected = "lobby_rejected"
+)
+
+// lobby holds the clients waiting for a moderator to admit them. A waiting
+// client keeps its data channel but has no media permissions, the permissions it
+// joined with are given back on admission.
+type lobby struct {
+	mu      sync.Mutex
+	waiting map[string]waitingClient
+}
+
+type waitingClient struct {
+	client      *Client
+	role        Role
+	permissions Permissions
+}
+
+type LobbyRejectedMessage struct {
+	Reason string `json:"reason"`
+}
+
+func newLobby() *lobby {
+	return &lobby{
+		mu:      sync.Mutex{},
+		waiting: make(map[string]waitingClient),
+	}
+}
+
+func (l *lobby) add(client *Client, role Role, permissions Permissions) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	client.waiting.Store(true)
+
+	l.waiting[client.ID()] = waitingClient{
+		client:      client,
+		role:        role,
+		permissions: permissions,
+	}
+}
+
+func (l *lobby) remove(clientID string) (waitingClient, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	waiting, ok := l.waiting[clientID]
+	delete(l.waiting, clientID)
+
+	if ok {
+		waiting.client.waiting.Store(false)
+	}
+
+	return waiting, ok
+}
+
+// update changes the permissions a waiting client gets on admission, it reports
+// false when the client isn't waiting.
+func (l *lobby) update(clientID string, role Role, permissions Permissions) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	waiting, ok := l.waiting[clientID]
+	if !ok {
+		return false
+	}
+
+	waiting.role = role
+	waiting.permissions = permissions
+	l.waiting[clientID] = waiting
+
+	return true
+}
+
+// admit removes the waiting client and gives it the permissions it waited with.
+// The lock is held until they are applied, so a permission change made during
+// the admission applies after them instead of being overwritten.
+func (l *lobby) admit(clientID string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	waiting, ok := l.waiting[clientID]
+	if !ok {
+		return false
+	}
+
+	delete(l.waiting, clientID)
+	waiting.client.waiting.Store(false)
+
+	if err := waiting.client.sendInternalMessage(LobbyAdmittedMessage{}); err != nil {
+		waiting.client.log.Debugf("client: failed to send admission to %s: %s", clientID, err.Error())
+	}
+
+	waiting.client.updatePermissions(waiting.role, waiting.permissions)
+
+	return true
+}
+
+func (l *lobby) isWaiting(clientID string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_, ok := l.waiting[clientID]
+
+	return ok
+}
+
+func (l *lobby) clients() []*Client {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	clients := make([]*Client, 0, len(l.waiting))
+	for _, waiting := range l.waiting {
+		clients = append(clients, waiting.client)
+	}
+
+	return clients
+}
+
+// WaitingClients returns the clients waiting in the lobby.
+func (r *Room) WaitingClients() []*Client {
+	return r.lobby.clients()
+}
+
+func (r *Room) IsWaiting(clientID string) bool {
+	return r.lobby.isWaiting(clientID)
+}
+
+func (r *Room) OnClientWaiting(callback func(*Client)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.onWaitingCallbacks = append(r.onWaitingCallbacks, callback)
+}
+
+func (r *Room) onClientWaiting(client *Client) {
+	r.mu.RLock()
+	callbacks := r.onWaitingCallbacks
+	r.mu.RUnlock()
+
+	for _, callback := range callbacks {
+		callback(client)
+	}
+
+	r.onEvent(EventTypeClientWaiting, map[string]any{
+		"client_id": client.ID(),
+		"name":      client.Name(),
+	})
+}
+
+// AdmitClient lets a waiting client into the room, its media is negotiated with
+// the permissions it joined with, or the ones set while it was waiting.
+func (r *Room) AdmitClient(clientID string) error {
+	if !r.lobby.admit(clientID) {
+		return ErrClientNotWaiting
+	}
+
+	r.onEvent(EventTypeClientAdmitted, map[string]any{
+		"client_id": clientID,
+	})
+
+	return nil
+}
+
+// RejectClient stops a waiting client with the reason, once the rejection is sent
+// or after a short timeout.
+func (r *Room) RejectClient(clientID, reason string) error {
+	waiting, ok := r.lobby.remove(clientID)
+	if !ok {
+		return ErrClientNotWaiting
+	}
+
+	waiting.client.sendLastInternalMessage(LobbyRejectedMessage{Reason: reason})
+
+	r.onEvent(EventTypeClientRejected, map[string]any{
+		"client_id": clientID,
+		"reason":    reason,
+	})
+
+	if err := waiting.client.StopWithReason(reason); err != nil && err != ErrClientStopped {
+		return err
+	}
+
+	return nil
+}
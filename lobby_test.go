@@ -0,0 +1,142 @@
+package meetup
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func newTestLobbyRoom(t *testing.T) *Room {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	opts := DefaultRoomOptions()
+	opts.EnableLobby = true
+
+	room, err := NewManager(ctx, "test", DefaultOptions()).NewRoom("room", "room", RoomKindMeeting, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return room
+}
+
+func TestSetPermissionsOfWaitingClient(t *testing.T) {
+	room := newTestLobbyRoom(t)
+
+	client, err := room.AddClient("alice", "alice", DefaultClientOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !room.IsWaiting("alice") {
+		t.Fatal("alice should wait in the lobby")
+	}
+
+	if err := room.SetClientRole("alice", RoleViewer); err != nil {
+		t.Fatal(err)
+	}
+
+	if client.Permissions() != (Permissions{}) {
+		t.Errorf("permissions = %+v while waiting, want none", client.Permissions())
+	}
+
+	if err := room.AdmitClient("alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	viewer, err := PermissionsPreset(RoomKindMeeting, RoleViewer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if client.Role() != RoleViewer || client.Permissions() != viewer {
+		t.Errorf("admitted as %s with %+v, want %s with %+v", client.Role(), client.Permissions(), RoleViewer, viewer)
+	}
+
+	// once admitted the change applies right away
+	custom := viewer
+	custom.CanPublishData = !viewer.CanPublishData
+
+	if err := room.SetClientPermissions("alice", custom); err != nil {
+		t.Fatal(err)
+	}
+
+	if client.Permissions() != custom {
+		t.Errorf("permissions = %+v, want %+v", client.Permissions(), custom)
+	}
+
+	if err := room.AdmitClient("alice"); !errors.Is(err, ErrClientNotWaiting) {
+		t.Errorf("second admission = %v, want %v", err, ErrClientNotWaiting)
+	}
+}
+
+func TestRejectClientSendsRejectionFirst(t *testing.T) {
+	room := newTestLobbyRoom(t)
+
+	client, err := room.AddClient("alice", "alice", DefaultClientOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := room.RejectClient("alice", "not invited"); err != nil {
+		t.Fatal(err)
+	}
+
+	if client.State() != ClientStateEnded || client.StopReason() != "not invited" {
+		t.Errorf("client state %d with reason %q, want ended with the rejection reason", client.State(), client.StopReason())
+	}
+
+	// the rejection was queued before the client stopped
+	rejected := false
+
+	for _, payload := range client.pendingInternalMessages {
+		msg, err := DecodeInternalMessage(payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if m, ok := msg.(*LobbyRejectedMessage); ok && m.Reason == "not invited" {
+			rejected = true
+		}
+	}
+
+	if !rejected {
+		t.Error("the client should be sent the rejection")
+	}
+
+	if room.IsWaiting("alice") {
+		t.Error("a rejected client shouldn't wait anymore")
+	}
+
+	if err := room.RejectClient("alice", ""); !errors.Is(err, ErrClientNotWaiting) {
+		t.Errorf("second rejection = %v, want %v", err, ErrClientNotWaiting)
+	}
+}
+
+func TestWaitingClientCantOpenDataChannels(t *testing.T) {
+	room := newTestLobbyRoom(t)
+
+	client, err := room.AddClient("alice", "alice", DefaultClientOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client.onClientDataChannel(newTestDataChannel(t, "chat"))
+
+	if len(room.SFU().DataChannels()) != 0 {
+		t.Error("a waiting client shouldn't add a room data channel")
+	}
+
+	if err := room.AdmitClient("alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	client.onClientDataChannel(newTestDataChannel(t, "chat"))
+
+	if len(room.SFU().DataChannels()) != 1 {
+		t.Error("an admitted client should add the room data channel")
+	}
+}
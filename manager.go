@@ -42,5 +42,80 @@ func (m *Manager) CreateRoomID() string {
 	return GenerateID(16)
 }
 
-// func (m *Manager) NewRoom(id, name, roomType string, opts RoomOptions) (*Room, error) {
-// }
+func (m *Manager) NewRoom(id, name, roomType string, opts RoomOptions) (*Room, error) {
+	m.mutext.Lock()
+	defer m.mutext.Unlock()
+
+	if _, ok := m.rooms[id]; ok {
+		return nil, ErrRoomExists
+	}
+
+	defaultOpts := DefaultRoomOptions()
+
+	if opts.Codecs == nil {
+		opts.Codecs = defaultOpts.Codecs
+	}
+
+	if opts.PLIInterval == nil {
+		opts.PLIInterval = defaultOpts.PLIInterval
+	}
+
+	if opts.AudioTopNHold == nil {
+		opts.AudioTopNHold = defaultOpts.AudioTopNHold
+	}
+
+	if opts.AudioTopNMinClients == nil {
+		opts.AudioTopNMinClients = defaultOpts.AudioTopNMinClients
+	}
+
+	if len(opts.QualityLevels) == 0 {
+		opts.QualityLevels = defaultOpts.QualityLevels
+	}
+
+	if opts.Bitrates == (BitrateConfigs{}) {
+		opts.Bitrates = defaultOpts.Bitrates
+	}
+
+	sfuOpts := sfuOptions{
+		IceServers:              m.iceServers,
+		Bitrates:                opts.Bitrates,
+		QualityLevel:            opts.QualityLevels,
+		Codecs:                  *opts.Codecs,
+		PLIInterval:             *opts.PLIInterval,
+		Log:                     m.log,
+		SettingEngine:           m.options.SettingEngine,
+		EnableBandwithEstimator: m.options.EnableBandwithEstimator,
+		LastN:                   opts.LastN,
+		AudioTopN:               opts.AudioTopN,
+		AudioTopNHold:           *opts.AudioTopNHold,
+		AudioTopNMinClients:     *opts.AudioTopNMinClients,
+		DataChannelHistory:      opts.DataChannelHistory,
+		MaxDataChannels:         opts.MaxDataChannels,
+		MaxClients:              opts.MaxClients,
+	}
+
+	room := newRoom(m.context, id, name, New(m.context, sfuOpts), roomType, opts)
+
+	room.OnRoomClosed(func(id string) {
+		m.mutext.Lock()
+		defer m.mutext.Unlock()
+
+		delete(m.rooms, id)
+	})
+
+	m.rooms[id] = room
+
+	return room, nil
+}
+
+func (m *Manager) GetRoom(id string) (*Room, error) {
+	m.mutext.RLock()
+	defer m.mutext.RUnlock()
+
+	room, ok := m.rooms[id]
+	if !ok {
+		return nil, ErrRoomNotFound
+	}
+
+	return room, nil
+}
@@ -0,0 +1,26 @@
+package meetup
+
+import (
+	"context"
+	"testing"
+)
+
+func TestManagerNewRoomDefaults(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	m := NewManager(ctx, "test", DefaultOptions())
+
+	room, err := m.NewRoom("room", "room", RoomKindMeeting, RoomOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if room.SFU().bitrateConfigs != DefaultBitrates() {
+		t.Errorf("bitrates = %+v, want the defaults %+v", room.SFU().bitrateConfigs, DefaultBitrates())
+	}
+
+	if len(room.SFU().qualityLevels) == 0 {
+		t.Error("quality levels should default")
+	}
+}
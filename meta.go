@@ -1,9 +1,481 @@
 package meetup
 
-import "sync"
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+)
 
+const (
+	MetadataScopeRoom   = "room"
+	MetadataScopeClient = "client"
+
+	messageTypeMetadataChanged  = "metadata_changed"
+	messageTypeMetadataSnapshot = "metadata_snapshot"
+	messageTypeMetadataConflict = "metadata_conflict"
+	messageTypeSetMetadata      = "set_metadata"
+	messageTypeDeleteMetadata   = "delete_metadata"
+)
+
+const metadataHistorySize = 256
+
+var (
+	ErrMetadataType      = errors.New("metadata: error value has another type")
+	ErrVersionConflict   = errors.New("metadata: error entry version doesn't match")
+	ErrRevisionTooOld    = errors.New("metadata: error revision is older than the kept changes")
+	ErrRevisionTooRecent = errors.New("metadata: error revision is newer than the store")
+)
+
+// Metadata is a versioned key value store of a room or a client. Every entry has
+// a version that grows with each write, and every change gets the next revision
+// of the store so a client can catch up from a snapshot with the later changes.
+// Setting nil deletes the key, a deletion is announced with a nil value.
+//
+// The versions of a key never go back, a deleted key keeps its last version so
+// a recreated key can't be mistaken for an older one in a compare and set.
 type Metadata struct {
 	mu                 sync.RWMutex
-	m                  map[string]any
-	onChangedCallbacks map[string]func(key string, value any)
+	m                  map[string]MetadataEntry
+	versions           map[string]uint64
+	revision           uint64
+	history            []MetadataChange
+	onChangedCallbacks map[string]func(change MetadataChange)
+}
+
+type MetadataEntry struct {
+	Value   any    `json:"value"`
+	Version uint64 `json:"version"`
+}
+
+type MetadataChange struct {
+	Revision uint64 `json:"revision"`
+	Key      string `json:"key"`
+	Value    any    `json:"value"`
+	Version  uint64 `json:"version"`
+	Deleted  bool   `json:"deleted,omitempty"`
+}
+
+type MetadataSnapshot struct {
+	Revision uint64                   `json:"revision"`
+	Entries  map[string]MetadataEntry `json:"entries"`
+}
+
+func NewMetadata() *Metadata {
+	return &Metadata{
+		mu:                 sync.RWMutex{},
+		m:                  make(map[string]MetadataEntry),
+		versions:           make(map[string]uint64),
+		history:            make([]MetadataChange, 0, metadataHistorySize),
+		onChangedCallbacks: make(map[string]func(change MetadataChange)),
+	}
+}
+
+func (m *Metadata) Set(key string, value any) {
+	m.mu.Lock()
+	change, changed := m.write(key, value)
+	m.mu.Unlock()
+
+	if changed {
+		m.onChanged(change)
+	}
+}
+
+// CompareAndSet writes the value only when the entry is still at the expected
+// version, 0 expects the key to be missing. It returns the new version, or the
+// current one with ErrVersionConflict.
+func (m *Metadata) CompareAndSet(key string, expectedVersion uint64, value any) (uint64, error) {
+	m.mu.Lock()
+
+	current := m.m[key].Version
+	if current != expectedVersion {
+		m.mu.Unlock()
+		return current, ErrVersionConflict
+	}
+
+	change, changed := m.write(key, value)
+	m.mu.Unlock()
+
+	if changed {
+		m.onChanged(change)
+	}
+
+	return change.Version, nil
+}
+
+// write applies a change, the caller holds the lock. Deleting a missing key is
+// not a change.
+func (m *Metadata) write(key string, value any) (MetadataChange, bool) {
+	_, exists := m.m[key]
+	if value == nil && !exists {
+		return MetadataChange{}, false
+	}
+
+	m.revision++
+	m.versions[key]++
+
+	change := MetadataChange{
+		Revision: m.revision,
+		Key:      key,
+		Value:    value,
+		Version:  m.versions[key],
+		Deleted:  value == nil,
+	}
+
+	if change.Deleted {
+		delete(m.m, key)
+	} else {
+		m.m[key] = MetadataEntry{Value: value, Version: change.Version}
+	}
+
+	if len(m.history) == metadataHistorySize {
+		m.history = append(m.history[:0], m.history[1:]...)
+	}
+
+	m.history = append(m.history, change)
+
+	return change, true
+}
+
+func (m *Metadata) Get(key string) (any, error) {
+	value, _, err := m.GetVersioned(key)
+
+	return value, err
+}
+
+func (m *Metadata) GetVersioned(key string) (any, uint64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	entry, ok := m.m[key]
+	if !ok {
+		return nil, 0, ErrNotFound
+	}
+
+	return entry.Value, entry.Version, nil
+}
+
+func (m *Metadata) Delete(key string) error {
+	m.mu.Lock()
+
+	if _, ok := m.m[key]; !ok {
+		m.mu.Unlock()
+		return ErrNotFound
+	}
+
+	change, _ := m.write(key, nil)
+	m.mu.Unlock()
+
+	m.onChanged(change)
+
+	return nil
+}
+
+// ForEach calls the callback with every entry, the store can't be changed from
+// the callback.
+func (m *Metadata) ForEach(callback func(key string, value any)) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for key, entry := range m.m {
+		callback(key, entry.Value)
+	}
+}
+
+func (m *Metadata) Revision() uint64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.revision
+}
+
+func (m *Metadata) Snapshot() MetadataSnapshot {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	entries := make(map[string]MetadataEntry, len(m.m))
+	for key, entry := range m.m {
+		entries[key] = entry
+	}
+
+	return MetadataSnapshot{
+		Revision: m.revision,
+		Entries:  entries,
+	}
+}
+
+// ChangesSince returns the changes after the revision, ErrRevisionTooOld means
+// they are not kept anymore and a snapshot is needed.
+func (m *Metadata) ChangesSince(revision uint64) ([]MetadataChange, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if revision > m.revision {
+		return nil, ErrRevisionTooRecent
+	}
+
+	changes := make([]MetadataChange, 0)
+	if revision == m.revision {
+		return changes, nil
+	}
+
+	if len(m.history) == 0 || m.history[0].Revision > revision+1 {
+		return nil, ErrRevisionTooOld
+	}
+
+	for _, change := range m.history {
+		if change.Revision > revision {
+			changes = append(changes, change)
+		}
+	}
+
+	return changes, nil
+}
+
+// OnChanged registers a callback for the changes and returns its ID for
+// RemoveOnChanged.
+func (m *Metadata) OnChanged(callback func(key string, value any)) string {
+	return m.OnChange(func(change MetadataChange) {
+		callback(change.Key, change.Value)
+	})
+}
+
+// OnChange is OnChanged with the versions of the change.
+func (m *Metadata) OnChange(callback func(change MetadataChange)) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := GenerateID(16)
+	m.onChangedCallbacks[id] = callback
+
+	return id
+}
+
+func (m *Metadata) RemoveOnChanged(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.onChangedCallbacks, id)
+}
+
+func (m *Metadata) onChanged(change MetadataChange) {
+	m.mu.RLock()
+	callbacks := make([]func(change MetadataChange), 0, len(m.onChangedCallbacks))
+	for _, callback := range m.onChangedCallbacks {
+		callbacks = append(callbacks, callback)
+	}
+	m.mu.RUnlock()
+
+	for _, callback := range callbacks {
+		callback(change)
+	}
+}
+
+func (m *Metadata) GetString(key string) (string, error) {
+	return metadataValue[string](m, key)
+}
+
+func (m *Metadata) GetBool(key string) (bool, error) {
+	return metadataValue[bool](m, key)
+}
+
+// GetFloat returns a number, values decoded from JSON are always float64.
+func (m *Metadata) GetFloat(key string) (float64, error) {
+	value, err := m.Get(key)
+	if err != nil {
+		return 0, err
+	}
+
+	switch number := value.(type) {
+	case float64:
+		return number, nil
+	case float32:
+		return float64(number), nil
+	case int:
+		return float64(number), nil
+	case int64:
+		return float64(number), nil
+	default:
+		return 0, ErrMetadataType
+	}
+}
+
+func (m *Metadata) GetInt(key string) (int, error) {
+	value, err := m.Get(key)
+	if err != nil {
+		return 0, err
+	}
+
+	switch number := value.(type) {
+	case int:
+		return number, nil
+	case int64:
+		return int(number), nil
+	case float64:
+		if number != float64(int(number)) {
+			return 0, ErrMetadataType
+		}
+
+		return int(number), nil
+	default:
+		return 0, ErrMetadataType
+	}
+}
+
+func metadataValue[T any](m *Metadata, key string) (T, error) {
+	var zero T
+
+	value, err := m.Get(key)
+	if err != nil {
+		return zero, err
+	}
+
+	typed, ok := value.(T)
+	if !ok {
+		return zero, ErrMetadataType
+	}
+
+	return typed, nil
+}
+
+type MetadataChangedMessage struct {
+	Scope    string `json:"scope"`
+	ClientID string `json:"client_id,omitempty"`
+	MetadataChange
+}
+
+type MetadataSnapshotMessage struct {
+	Scope    string `json:"scope"`
+	ClientID string `json:"client_id,omitempty"`
+	MetadataSnapshot
+}
+
+// SetMetadataMessage changes a key, with an expected version the change is a
+// compare and set that fails on a concurrent change.
+type SetMetadataMessage struct {
+	Type            string          `json:"-"`
+	Scope           string          `json:"scope"`
+	Key             string          `json:"key"`
+	Value           json.RawMessage `json:"value"`
+	ExpectedVersion *uint64         `json:"expected_version,omitempty"`
+}
+
+type MetadataConflictMessage struct {
+	Scope   string `json:"scope"`
+	Key     string `json:"key"`
+	Version uint64 `json:"version"`
+}
+
+// Metadata returns the metadata of the room, its changes are sent to every
+// client over the internal data channel.
+func (r *Room) Metadata() *Metadata {
+	return r.meta
+}
+
+// Metadata returns the metadata of the client such as a raised hand, its changes
+// are sent to every client over the internal data channel.
+func (c *Client) Metadata() *Metadata {
+	return c.meta
+}
+
+func (r *Room) broadcastMetadata(change MetadataChange) {
+	r.sfu.broadcastInternalMessage(MetadataChangedMessage{
+		Scope:          MetadataScopeRoom,
+		MetadataChange: change,
+	})
+
+	r.onEvent(EventTypeMetadataChanged, map[string]any{
+		"scope":    MetadataScopeRoom,
+		"key":      change.Key,
+		"value":    change.Value,
+		"version":  change.Version,
+		"revision": change.Revision,
+	})
+}
+
+func (c *Client) broadcastMetadata(change MetadataChange) {
+	c.sfu.broadcastInternalMessage(MetadataChangedMessage{
+		Scope:          MetadataScopeClient,
+		ClientID:       c.ID(),
+		MetadataChange: change,
+	})
+}
+
+// sendMetadataSnapshot sends the room metadata and the metadata of every client to
+// a client that just opened its data channel, the later changes follow as
+// metadata_changed messages.
+func (c *Client) sendMetadataSnapshot() {
+	if err := c.sendInternalMessage(MetadataSnapshotMessage{
+		Scope:            MetadataScopeRoom,
+		MetadataSnapshot: c.sfu.meta.Snapshot(),
+	}); err != nil {
+		c.log.Debugf("client: failed to send metadata snapshot to %s: %s", c.ID(), err.Error())
+	}
+
+	for _, client := range c.sfu.GetClients() {
+		if err := c.sendInternalMessage(MetadataSnapshotMessage{
+			Scope:            MetadataScopeClient,
+			ClientID:         client.ID(),
+			MetadataSnapshot: client.meta.Snapshot(),
+		}); err != nil {
+			c.log.Debugf("client: failed to send metadata snapshot of %s to %s: %s", client.ID(), c.ID(), err.Error())
+		}
+	}
+}
+
+// MetadataFor returns the metadata the client may change, its own and the room
+// metadata for moderators.
+func (c *Client) MetadataFor(scope string) (*Metadata, error) {
+	switch scope {
+	case MetadataScopeClient, "":
+		if !c.Permissions().CanPublishData {
+			return nil, ErrPermissionDenied
+		}
+
+		return c.meta, nil
+	case MetadataScopeRoom:
+		if !c.Permissions().IsModerator {
+			return nil, ErrPermissionDenied
+		}
+
+		return c.sfu.meta, nil
+	default:
+		return nil, ErrNotFound
+	}
+}
+
+func (c *Client) onMetadataMessage(msg *SetMetadataMessage) error {
+	meta, err := c.MetadataFor(msg.Scope)
+	if err != nil {
+		return err
+	}
+
+	var value any
+	if msg.Type != messageTypeDeleteMetadata {
+		if err := json.Unmarshal(msg.Value, &value); err != nil {
+			return ErrDecodingData
+		}
+	}
+
+	if msg.ExpectedVersion != nil {
+		version, err := meta.CompareAndSet(msg.Key, *msg.ExpectedVersion, value)
+		if errors.Is(err, ErrVersionConflict) {
+			// the sender retries from the current version, the change that won
+			// reached it as metadata_changed
+			return c.sendInternalMessage(MetadataConflictMessage{
+				Scope:   msg.Scope,
+				Key:     msg.Key,
+				Version: version,
+			})
+		}
+
+		return err
+	}
+
+	if msg.Type == messageTypeDeleteMetadata {
+		return meta.Delete(msg.Key)
+	}
+
+	meta.Set(msg.Key, value)
+
+	return nil
 }
@@ -0,0 +1,194 @@
+package meetup
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMetadataCompareAndSet(t *testing.T) {
+	m := NewMetadata()
+
+	version, err := m.CompareAndSet("hand", 0, true)
+	if err != nil || version != 1 {
+		t.Fatalf("create = %d, %v, want 1, nil", version, err)
+	}
+
+	version, err = m.CompareAndSet("hand", 0, false)
+	if !errors.Is(err, ErrVersionConflict) || version != 1 {
+		t.Errorf("create of an existing key = %d, %v, want 1, %v", version, err, ErrVersionConflict)
+	}
+
+	version, err = m.CompareAndSet("hand", 1, false)
+	if err != nil || version != 2 {
+		t.Fatalf("update = %d, %v, want 2, nil", version, err)
+	}
+
+	version, err = m.CompareAndSet("hand", 1, true)
+	if !errors.Is(err, ErrVersionConflict) || version != 2 {
+		t.Errorf("stale update = %d, %v, want 2, %v", version, err, ErrVersionConflict)
+	}
+
+	if value, _ := m.Get("hand"); value != false {
+		t.Errorf("value = %v after a failed update, want false", value)
+	}
+}
+
+func TestMetadataDeleteThenRecreate(t *testing.T) {
+	m := NewMetadata()
+
+	changes := make([]MetadataChange, 0)
+	m.OnChange(func(change MetadataChange) {
+		changes = append(changes, change)
+	})
+
+	m.Set("topic", "a")
+	m.Set("topic", "b")
+
+	if err := m.Delete("topic"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.CompareAndSet("topic", 2, "stale"); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("compare and set on a deleted key = %v, want %v", err, ErrVersionConflict)
+	}
+
+	version, err := m.CompareAndSet("topic", 0, "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if version != 4 {
+		t.Errorf("version of the recreated key = %d, want 4", version)
+	}
+
+	// a client that saw the key at version 1 before the delete must not overwrite
+	// the recreated key
+	m.Set("topic", "d")
+	m.Set("topic", nil)
+	m.Set("topic", "e")
+
+	if _, err := m.CompareAndSet("topic", 1, "stale"); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("compare and set with a version of a previous key = %v, want %v", err, ErrVersionConflict)
+	}
+
+	previous := uint64(0)
+	for _, change := range changes {
+		if change.Version <= previous {
+			t.Errorf("version %d of revision %d doesn't grow after %d", change.Version, change.Revision, previous)
+		}
+
+		previous = change.Version
+	}
+
+	if last := changes[len(changes)-1]; last.Version != 7 || last.Deleted {
+		t.Errorf("last change = %+v, want version 7 not deleted", last)
+	}
+}
+
+func TestMetadataSnapshotAndChanges(t *testing.T) {
+	m := NewMetadata()
+
+	m.Set("a", 1)
+	m.Set("b", 2)
+
+	snapshot := m.Snapshot()
+	if snapshot.Revision != 2 || len(snapshot.Entries) != 2 {
+		t.Fatalf("snapshot = %+v, want revision 2 with 2 entries", snapshot)
+	}
+
+	m.Set("a", 3)
+	m.Set("b", nil)
+	m.Set("c", 4)
+
+	changes, err := m.ChangesSince(snapshot.Revision)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// applying the changes in order to the snapshot gives the current store
+	entries := snapshot.Entries
+	for i, change := range changes {
+		if change.Revision != snapshot.Revision+uint64(i)+1 {
+			t.Errorf("change %d has revision %d, want %d", i, change.Revision, snapshot.Revision+uint64(i)+1)
+		}
+
+		if change.Deleted {
+			delete(entries, change.Key)
+			continue
+		}
+
+		entries[change.Key] = MetadataEntry{Value: change.Value, Version: change.Version}
+	}
+
+	current := m.Snapshot()
+	if len(entries) != len(current.Entries) {
+		t.Fatalf("entries = %v, want %v", entries, current.Entries)
+	}
+
+	for key, entry := range current.Entries {
+		if entries[key] != entry {
+			t.Errorf("entry %s = %+v, want %+v", key, entries[key], entry)
+		}
+	}
+
+	if changes, err := m.ChangesSince(current.Revision); err != nil || len(changes) != 0 {
+		t.Errorf("changes since the current revision = %v, %v, want none", changes, err)
+	}
+
+	if _, err := m.ChangesSince(current.Revision + 1); !errors.Is(err, ErrRevisionTooRecent) {
+		t.Errorf("changes since a future revision = %v, want %v", err, ErrRevisionTooRecent)
+	}
+
+	for i := 0; i < metadataHistorySize; i++ {
+		m.Set("a", i)
+	}
+
+	if _, err := m.ChangesSince(snapshot.Revision); !errors.Is(err, ErrRevisionTooOld) {
+		t.Errorf("changes since a dropped revision = %v, want %v", err, ErrRevisionTooOld)
+	}
+}
+
+func TestMetadataSnapshotOfClients(t *testing.T) {
+	s := newTestSFU()
+	s.meta = NewMetadata()
+	s.meta.Set("topic", "news")
+
+	alice := newTestRoomClient(s, "alice", ClientOptions{})
+	alice.meta = NewMetadata()
+	alice.meta.Set("hand", true)
+
+	bob := newTestRoomClient(s, "bob", ClientOptions{})
+	bob.meta = NewMetadata()
+
+	// bob opens its data channel after alice raised her hand
+	bob.sendMetadataSnapshot()
+
+	snapshots := make(map[string]*MetadataSnapshotMessage)
+
+	for _, payload := range bob.pendingInternalMessages {
+		msg, err := DecodeInternalMessage(payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if snapshot, ok := msg.(*MetadataSnapshotMessage); ok {
+			snapshots[snapshot.Scope+"/"+snapshot.ClientID] = snapshot
+		}
+	}
+
+	if len(snapshots) != 3 {
+		t.Fatalf("snapshots = %v, want the room, alice and bob", snapshots)
+	}
+
+	if room := snapshots[MetadataScopeRoom+"/"]; room == nil || room.Entries["topic"].Value != "news" {
+		t.Errorf("room snapshot = %+v, want the topic", room)
+	}
+
+	if hand := snapshots[MetadataScopeClient+"/alice"]; hand == nil || hand.Entries["hand"].Value != true || hand.Revision != 1 {
+		t.Errorf("snapshot of alice = %+v, want the raised hand", hand)
+	}
+
+	if own := snapshots[MetadataScopeClient+"/bob"]; own == nil || len(own.Entries) != 0 {
+		t.Errorf("snapshot of bob = %+v, want empty", own)
+	}
+}
@@ -0,0 +1,146 @@
+package meetup
+
+type TrackUnpublishedMessage struct {
+	ClientID string `json:"client_id"`
+	TrackID  string `json:"track_id"`
+}
+
+func (c *Client) getPublishedTrack(trackID string) (*Track, error) {
+	track, err := c.publishedTracks.Get(trackID)
+	if err != nil {
+		return nil, err
+	}
+
+	t, ok := track.(*Track)
+	if !ok {
+		return nil, ErrTrackIsNotExists
+	}
+
+	return t, nil
+}
+
+// MuteTrack stops forwarding a published track to every subscriber without a
+// renegotiation. The publisher can lift a soft mute itself by unmuting the track,
+// a hard mute can only be lifted with UnmuteTrack.
+func (c *Client) MuteTrack(trackID string, hard bool) error {
+	track, err := c.getPublishedTrack(trackID)
+	if err != nil {
+		return err
+	}
+
+	reason := muteReasonModerator
+	if hard {
+		reason |= muteReasonModeratorHard
+	}
+
+	track.updateMute(reason, 0)
+
+	return nil
+}
+
+// UnmuteTrack lifts the moderator mute of a published track.
+func (c *Client) UnmuteTrack(trackID string) error {
+	track, err := c.getPublishedTrack(trackID)
+	if err != nil {
+		return err
+	}
+
+	track.updateMute(0, muteReasonModerator|muteReasonModeratorHard)
+
+	return nil
+}
+
+// SetTrackMuted records the publisher muting or unmuting its own track. Unmuting
+// also lifts a soft moderator mute but fails while the track is hard muted.
+func (c *Client) SetTrackMuted(trackID string, muted bool) error {
+	track, err := c.getPublishedTrack(trackID)
+	if err != nil {
+		return err
+	}
+
+	if muted {
+		track.updateMute(muteReasonPublisher, 0)
+		return nil
+	}
+
+	if track.IsHardMuted() {
+		track.updateMute(0, muteReasonPublisher)
+		return ErrTrackHardMuted
+	}
+
+	track.updateMute(0, muteReasonPublisher|muteReasonModerator)
+
+	return nil
+}
+
+// UnpublishTrack stops receiving a published track and renegotiates it away, the
+// subscribers drop the track once it ends.
+func (c *Client) UnpublishTrack(trackID string) error {
+	track, err := c.getPublishedTrack(trackID)
+	if err != nil {
+		return err
+	}
+
+	for _, transceiver := range c.peerConnection.PC().GetTransceivers() {
+		receiver := transceiver.Receiver()
+		if receiver == nil || receiver.Track() == nil || receiver.Track().ID() != trackID {
+			continue
+		}
+
+		if transceiver.Kind() != track.Kind() {
+			continue
+		}
+
+		if err := transceiver.Stop(); err != nil {
+			c.log.Errorf("client: error stopping transceiver of track %s: %s", trackID, err.Error())
+		}
+	}
+
+	c.publishedTracks.Remove(trackID)
+	track.stop()
+
+	c.sfu.broadcastInternalMessage(TrackUnpublishedMessage{
+		ClientID: c.ID(),
+		TrackID:  trackID,
+	})
+
+	c.renegotiate()
+
+	return nil
+}
+
+func (r *Room) MuteTrack(clientID, trackID string, hard bool) error {
+	client, err := r.sfu.GetClient(clientID)
+	if err != nil {
+		return err
+	}
+
+	return client.MuteTrack(trackID, hard)
+}
+
+func (r *Room) UnmuteTrack(clientID, trackID string) error {
+	client, err := r.sfu.GetClient(clientID)
+	if err != nil {
+		return err
+	}
+
+	return client.UnmuteTrack(trackID)
+}
+
+func (r *Room) UnpublishTrack(clientID, trackID string) error {
+	client, err := r.sfu.GetClient(clientID)
+	if err != nil {
+		return err
+	}
+
+	if err := client.UnpublishTrack(trackID); err != nil {
+		return err
+	}
+
+	r.onEvent(EventTypeTrackUnpublished, map[string]any{
+		"client_id": clientID,
+		"track_id":  trackID,
+	})
+
+	return nil
+}
@@ -0,0 +1,287 @@
+package meetup
+
+import (
+	"errors"
+
+	"github.com/pion/webrtc/v4"
+)
+
+const (
+	RoomKindMeeting   = "meeting"
+	RoomKindWebinar   = "webinar"
+	RoomKindAudioRoom = "audio-room"
+
+	RoleModerator Role = "moderator"
+	RoleSpeaker   Role = "speaker"
+	RoleViewer    Role = "viewer"
+
+	messageTypePermissionsChanged = "permissions_changed"
+)
+
+var (
+	ErrPermissionDenied = errors.New("client: error permission denied")
+	ErrUnknownRole      = errors.New("client: error unknown role")
+)
+
+// Role names a permission preset of the room kind.
+type Role string
+
+// Permissions are what a client is allowed to do in a room.
+type Permissions struct {
+	CanPublishAudio  bool `json:"can_publish_audio"`
+	CanPublishVideo  bool `json:"can_publish_video"`
+	CanPublishScreen bool `json:"can_publish_screen"`
+	CanSubscribe     bool `json:"can_subscribe"`
+	CanPublishData   bool `json:"can_publish_data"`
+	IsModerator      bool `json:"is_moderator"`
+}
+
+// DefaultPermissions are the permissions of a speaker in a meeting, everything
+// but moderation is allowed.
+func DefaultPermissions() Permissions {
+	return Permissions{
+		CanPublishAudio:  true,
+		CanPublishVideo:  true,
+		CanPublishScreen: true,
+		CanSubscribe:     true,
+		CanPublishData:   true,
+	}
+}
+
+// DefaultRole is the role of the clients joining a room of the kind without a
+// role in their token. Everyone speaks in a meeting, the others start as viewers.
+func DefaultRole(kind string) Role {
+	switch kind {
+	case RoomKindWebinar, RoomKindAudioRoom:
+		return RoleViewer
+	default:
+		return RoleSpeaker
+	}
+}
+
+// PermissionsPreset returns the permissions of a role in a room of the kind, an
+// unknown kind uses the meeting presets. Audio rooms never carry video.
+func PermissionsPreset(kind string, role Role) (Permissions, error) {
+	permissions := Permissions{
+		CanSubscribe:   true,
+		CanPublishData: true,
+	}
+
+	switch role {
+	case RoleModerator:
+		permissions = DefaultPermissions()
+		permissions.IsModerator = true
+	case RoleSpeaker:
+		permissions = DefaultPermissions()
+	case RoleViewer:
+	default:
+		return Permissions{}, ErrUnknownRole
+	}
+
+	if kind == RoomKindAudioRoom {
+		permissions.CanPublishVideo = false
+		permissions.CanPublishScreen = false
+	}
+
+	return permissions, nil
+}
+
+func (p Permissions) canPublish(kind webrtc.RTPCodecType, sourceType TrackType) bool {
+	switch {
+	case sourceType == TrackTypeScreen:
+		return p.CanPublishScreen
+	case kind == webrtc.RTPCodecTypeAudio:
+		return p.CanPublishAudio
+	case kind == webrtc.RTPCodecTypeVideo:
+		return p.CanPublishVideo
+	default:
+		return false
+	}
+}
+
+// Permissions returns what the client is allowed to do in the room, given by its
+// join token or the defaults when the room doesn't require tokens.
+func (c *Client) Permissions() Permissions {
+	return c.permissions.Load().(Permissions)
+}
+
+// SetTrackSourceType marks a published track as a camera or microphone, or as
+// a screen share which needs its own permission.
+func (c *Client) SetTrackSourceType(trackID string, sourceType TrackType) error {
+	c.muPublish.Lock()
+	defer c.muPublish.Unlock()
+
+	track, err := c.publishedTracks.Get(trackID)
+	if err != nil {
+		return err
+	}
+
+	sourceType = c.trackSourceType(track.Kind(), trackID, sourceType)
+
+	if !c.Permissions().canPublish(track.Kind(), sourceType) {
+		return ErrPermissionDenied
+	}
+
+	track.SetSourceType(sourceType)
+
+	return nil
+}
+
+// trackSourceType returns the source a track is published as. The SFU can't tell
+// a camera from a screen share, so only one video track of a client counts as
+// its camera and the other ones are screen shares whatever the client declares.
+func (c *Client) trackSourceType(kind webrtc.RTPCodecType, trackID string, declared TrackType) TrackType {
+	if kind != webrtc.RTPCodecTypeVideo || declared == TrackTypeScreen {
+		return declared
+	}
+
+	for _, track := range c.PublishedTracks() {
+		if track.ID() != trackID && track.Kind() == webrtc.RTPCodecTypeVideo && track.SourceType() != TrackTypeScreen {
+			return TrackTypeScreen
+		}
+	}
+
+	return declared
+}
+
+// Role returns the role the client joined with or was last given, empty when
+// its permissions were set directly.
+func (c *Client) Role() Role {
+	return c.role.Load().(Role)
+}
+
+type PermissionsChangedMessage struct {
+	Role        Role        `json:"role"`
+	Permissions Permissions `json:"permissions"`
+}
+
+// updatePermissions applies new permissions to a connected client, the tracks it
+// may no longer publish are unpublished and its subscriptions follow the
+// subscribe permission. It returns the IDs of the unpublished tracks.
+func (c *Client) updatePermissions(role Role, permissions Permissions) []string {
+	previous := c.Permissions()
+
+	c.role.Store(role)
+	c.permissions.Store(permissions)
+
+	unpublished := make([]string, 0)
+
+	for _, track := range c.PublishedTracks() {
+		if permissions.canPublish(track.Kind(), track.SourceType()) {
+			continue
+		}
+
+		if err := c.UnpublishTrack(track.ID()); err != nil {
+			c.log.Errorf("client: error unpublishing track %s: %s", track.ID(), err.Error())
+			continue
+		}
+
+		unpublished = append(unpublished, track.ID())
+	}
+
+	switch {
+	case previous.CanSubscribe && !permissions.CanSubscribe:
+		c.unsubscribeAll()
+	case !previous.CanSubscribe && permissions.CanSubscribe:
+		c.subscribeAvailable()
+	}
+
+	if err := c.sendInternalMessage(PermissionsChangedMessage{
+		Role:        role,
+		Permissions: permissions,
+	}); err != nil {
+		c.log.Debugf("client: failed to send permissions to %s: %s", c.ID(), err.Error())
+	}
+
+	return unpublished
+}
+
+func (c *Client) unsubscribeAll() {
+	removed := 0
+
+	for _, ct := range c.ClientTracks() {
+		if err := c.removeClientTrack(ct.ID()); err == nil {
+			removed++
+		}
+	}
+
+	if removed > 0 {
+		c.renegotiate()
+	}
+}
+
+func (c *Client) subscribeAvailable() {
+	tracks := c.AvailableTracks()
+	if len(tracks) == 0 {
+		return
+	}
+
+	if !c.options.AutoSubscribe {
+		c.onTracksAvailable(tracks)
+		return
+	}
+
+	added := 0
+
+	for _, track := range tracks {
+		if _, err := c.addTrack(track); err == nil {
+			added++
+		}
+	}
+
+	if added > 0 {
+		c.renegotiate()
+	}
+}
+
+// SetClientRole gives a client the permissions of a role of the room kind, for
+// example to turn a webinar viewer into a speaker.
+func (r *Room) SetClientRole(clientID string, role Role) error {
+	permissions, err := PermissionsPreset(r.kind, role)
+	if err != nil {
+		return err
+	}
+
+	return r.setClientPermissions(clientID, role, permissions)
+}
+
+// SetClientPermissions changes the permissions of a client regardless of its
+// role, for example to revoke screen sharing.
+func (r *Room) SetClientPermissions(clientID string, permissions Permissions) error {
+	return r.setClientPermissions(clientID, "", permissions)
+}
+
+// setClientPermissions applies the permissions to a client in the room, a client
+// waiting in the lobby gets them on admission.
+func (r *Room) setClientPermissions(clientID string, role Role, permissions Permissions) error {
+	client, err := r.sfu.GetClient(clientID)
+	if err != nil {
+		return err
+	}
+
+	if r.lobby.update(clientID, role, permissions) {
+		r.onEvent(EventTypePermissionsChanged, map[string]any{
+			"client_id":   clientID,
+			"role":        role,
+			"permissions": permissions,
+			"waiting":     true,
+		})
+
+		return nil
+	}
+
+	for _, trackID := range client.updatePermissions(role, permissions) {
+		r.onEvent(EventTypeTrackUnpublished, map[string]any{
+			"client_id": clientID,
+			"track_id":  trackID,
+		})
+	}
+
+	r.onEvent(EventTypePermissionsChanged, map[string]any{
+		"client_id":   clientID,
+		"role":        role,
+		"permissions": permissions,
+	})
+
+	return nil
+}
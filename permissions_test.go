@@ -0,0 +1,96 @@
+package meetup
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/pion/webrtc/v4"
+)
+
+func newTestPublisher(permissions Permissions, tracks ...*Track) *Client {
+	c := &Client{
+		publishedTracks: newTrackList(),
+		permissions:     &atomic.Value{},
+	}
+
+	c.permissions.Store(permissions)
+
+	for _, track := range tracks {
+		if err := c.publishedTracks.Add(track); err != nil {
+			panic(err)
+		}
+	}
+
+	return c
+}
+
+func newTestPublishedTrack(id string, kind webrtc.RTPCodecType, sourceType TrackType) *Track {
+	var source atomic.Value
+	source.Store(sourceType)
+
+	return &Track{id: id, kind: kind, sourceType: &source}
+}
+
+func TestTrackSourceType(t *testing.T) {
+	camera := newTestPublishedTrack("camera", webrtc.RTPCodecTypeVideo, TrackTypeMedia)
+	screen := newTestPublishedTrack("screen", webrtc.RTPCodecTypeVideo, TrackTypeScreen)
+	microphone := newTestPublishedTrack("microphone", webrtc.RTPCodecTypeAudio, TrackTypeMedia)
+
+	testCases := []struct {
+		name     string
+		tracks   []*Track
+		kind     webrtc.RTPCodecType
+		trackID  string
+		declared TrackType
+		want     TrackType
+	}{
+		{"first video track is the camera", nil, webrtc.RTPCodecTypeVideo, "video", TrackTypeMedia, TrackTypeMedia},
+		{"video next to a screen share is the camera", []*Track{screen}, webrtc.RTPCodecTypeVideo, "video", TrackTypeMedia, TrackTypeMedia},
+		{"video next to an audio track is the camera", []*Track{microphone}, webrtc.RTPCodecTypeVideo, "video", TrackTypeMedia, TrackTypeMedia},
+		{"second video track is a screen share", []*Track{camera}, webrtc.RTPCodecTypeVideo, "video", TrackTypeMedia, TrackTypeScreen},
+		{"the camera stays the camera", []*Track{camera}, webrtc.RTPCodecTypeVideo, "camera", TrackTypeMedia, TrackTypeMedia},
+		{"declared screen share", nil, webrtc.RTPCodecTypeVideo, "video", TrackTypeScreen, TrackTypeScreen},
+		{"audio next to audio", []*Track{microphone}, webrtc.RTPCodecTypeAudio, "audio", TrackTypeMedia, TrackTypeMedia},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newTestPublisher(DefaultPermissions(), tc.tracks...)
+
+			if got := c.trackSourceType(tc.kind, tc.trackID, tc.declared); got != tc.want {
+				t.Errorf("trackSourceType = %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestScreenShareDeclaredAsCameraIsDenied(t *testing.T) {
+	permissions := DefaultPermissions()
+	permissions.CanPublishScreen = false
+
+	camera := newTestPublishedTrack("camera", webrtc.RTPCodecTypeVideo, TrackTypeMedia)
+	c := newTestPublisher(permissions, camera)
+
+	sourceType := c.trackSourceType(webrtc.RTPCodecTypeVideo, "screen", TrackTypeMedia)
+	if c.Permissions().canPublish(webrtc.RTPCodecTypeVideo, sourceType) {
+		t.Error("a second video track labelled as camera should need the screen permission")
+	}
+
+	// a screen share can't be relabelled as a second camera
+	screen := newTestPublishedTrack("screen", webrtc.RTPCodecTypeVideo, TrackTypeScreen)
+	c = newTestPublisher(DefaultPermissions(), camera, screen)
+	c.permissions.Store(permissions)
+
+	if err := c.SetTrackSourceType("screen", TrackTypeMedia); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("SetTrackSourceType = %v, want %v", err, ErrPermissionDenied)
+	}
+
+	if err := c.SetTrackSourceType("camera", TrackTypeScreen); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("SetTrackSourceType = %v, want %v", err, ErrPermissionDenied)
+	}
+
+	if err := c.SetTrackSourceType("camera", TrackTypeMedia); err != nil {
+		t.Errorf("SetTrackSourceType of the camera = %v, want nil", err)
+	}
+}
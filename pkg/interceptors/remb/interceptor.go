@@ -0,0 +1,98 @@
+package remb
+
+import (
+	"sync"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/rtcp"
+)
+
+type InterceptorFactory struct {
+	onNew func(i *Interceptor)
+}
+
+func NewInterceptor() *InterceptorFactory {
+	return &InterceptorFactory{}
+}
+
+func (g *InterceptorFactory) NewInterceptor(_ string) (interceptor.Interceptor, error) {
+	i := new()
+
+	if g.onNew != nil {
+		g.onNew(i)
+	}
+
+	return i, nil
+}
+
+func (g *InterceptorFactory) OnNew(callback func(i *Interceptor)) {
+	g.onNew = callback
+}
+
+type Interceptor struct {
+	interceptor.NoOp
+	mu        sync.RWMutex
+	bitrate   uint32
+	received  bool
+	onChanged func(bitrate uint32)
+}
+
+func new() *Interceptor {
+	return &Interceptor{
+		mu: sync.RWMutex{},
+	}
+}
+
+func (r *Interceptor) BindRTCPReader(reader interceptor.RTCPReader) interceptor.RTCPReader {
+	return interceptor.RTCPReaderFunc(func(b []byte, a interceptor.Attributes) (int, interceptor.Attributes, error) {
+		i, attr, err := reader.Read(b, a)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		if attr == nil {
+			attr = make(interceptor.Attributes)
+		}
+
+		pkts, err := attr.GetRTCPPackets(b[:i])
+		if err != nil {
+			return 0, nil, err
+		}
+
+		for _, pkt := range pkts {
+			if remb, ok := pkt.(*rtcp.ReceiverEstimatedMaximumBitrate); ok {
+				r.setBitrate(uint32(remb.Bitrate))
+			}
+		}
+
+		return i, attr, nil
+	})
+}
+
+func (r *Interceptor) setBitrate(bitrate uint32) {
+	r.mu.Lock()
+	changed := !r.received || r.bitrate != bitrate
+	r.bitrate = bitrate
+	r.received = true
+	callback := r.onChanged
+	r.mu.Unlock()
+
+	if changed && callback != nil {
+		callback(bitrate)
+	}
+}
+
+// Bitrate returns the latest REMB value and false if no REMB has been received yet.
+func (r *Interceptor) Bitrate() (uint32, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.bitrate, r.received
+}
+
+func (r *Interceptor) OnBitrateChanged(callback func(bitrate uint32)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.onChanged = callback
+}
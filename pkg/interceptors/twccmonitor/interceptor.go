@@ -0,0 +1,110 @@
+package twccmonitor
+
+import (
+	"sync"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/rtcp"
+)
+
+type InterceptorFactory struct {
+	onNew func(i *Interceptor)
+}
+
+func NewInterceptor() *InterceptorFactory {
+	return &InterceptorFactory{}
+}
+
+func (g *InterceptorFactory) NewInterceptor(_ string) (interceptor.Interceptor, error) {
+	i := new()
+
+	if g.onNew != nil {
+		g.onNew(i)
+	}
+
+	return i, nil
+}
+
+func (g *InterceptorFactory) OnNew(callback func(i *Interceptor)) {
+	g.onNew = callback
+}
+
+// Interceptor counts the packet statuses in the transport-wide congestion control
+// feedback we send back to a publisher, which gives the transport-wide loss of the
+// publisher's uplink across all of its streams.
+type Interceptor struct {
+	interceptor.NoOp
+	mu       sync.Mutex
+	received uint64
+	lost     uint64
+}
+
+func new() *Interceptor {
+	return &Interceptor{
+		mu: sync.Mutex{},
+	}
+}
+
+func (t *Interceptor) BindRTCPWriter(writer interceptor.RTCPWriter) interceptor.RTCPWriter {
+	return interceptor.RTCPWriterFunc(func(pkts []rtcp.Packet, attributes interceptor.Attributes) (int, error) {
+		for _, pkt := range pkts {
+			if feedback, ok := pkt.(*rtcp.TransportLayerCC); ok {
+				t.record(feedback)
+			}
+		}
+
+		return writer.Write(pkts, attributes)
+	})
+}
+
+func (t *Interceptor) record(feedback *rtcp.TransportLayerCC) {
+	var received, lost uint64
+
+	remaining := int(feedback.PacketStatusCount)
+
+	for _, chunk := range feedback.PacketChunks {
+		if remaining <= 0 {
+			break
+		}
+
+		switch c := chunk.(type) {
+		case *rtcp.RunLengthChunk:
+			count := min(int(c.RunLength), remaining)
+			if c.PacketStatusSymbol == rtcp.TypeTCCPacketNotReceived {
+				lost += uint64(count)
+			} else {
+				received += uint64(count)
+			}
+
+			remaining -= count
+		case *rtcp.StatusVectorChunk:
+			for _, symbol := range c.SymbolList {
+				if remaining <= 0 {
+					break
+				}
+
+				if symbol == rtcp.TypeTCCPacketNotReceived {
+					lost++
+				} else {
+					received++
+				}
+
+				remaining--
+			}
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.received += received
+	t.lost += lost
+}
+
+// Counters returns the total of packets reported as received and lost so far.
+func (t *Interceptor) Counters() (received uint64, lost uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.received, t.lost
+}
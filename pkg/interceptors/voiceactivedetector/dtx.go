@@ -0,0 +1,60 @@
+package voiceactivedetector
+
+import (
+	"strings"
+
+	"github.com/pion/webrtc/v4"
+)
+
+const (
+	mimeTypeRED = "audio/red"
+	// an Opus DTX frame only carries the TOC byte, some encoders add one more
+	opusDTXMaxSize = 2
+)
+
+// IsDTX reports whether the payload is an Opus DTX frame, the encoder sends one
+// of these instead of the silent frames it drops.
+func IsDTX(mimeType string, payload []byte) bool {
+	switch strings.ToLower(mimeType) {
+	case webrtc.MimeTypeOpus:
+		return len(payload) <= opusDTXMaxSize
+	case mimeTypeRED:
+		primary, ok := redPrimaryPayload(payload)
+		return ok && len(primary) <= opusDTXMaxSize
+	default:
+		return false
+	}
+}
+
+// redPrimaryPayload returns the primary encoding of a RED payload (RFC 2198), the
+// redundant blocks only repeat older frames.
+func redPrimaryPayload(payload []byte) ([]byte, bool) {
+	offset := 0
+	redundantLength := 0
+
+	for {
+		if offset >= len(payload) {
+			return nil, false
+		}
+
+		// the last header is a single byte with the F bit cleared
+		if payload[offset]&0x80 == 0 {
+			offset++
+			break
+		}
+
+		if offset+4 > len(payload) {
+			return nil, false
+		}
+
+		redundantLength += int(payload[offset+2]&0x03)<<8 | int(payload[offset+3])
+		offset += 4
+	}
+
+	offset += redundantLength
+	if offset > len(payload) {
+		return nil, false
+	}
+
+	return payload[offset:], true
+}
@@ -0,0 +1,190 @@
+package voiceactivedetector
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pion/logging"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+)
+
+func TestIsDTX(t *testing.T) {
+	opusFrame := bytes.Repeat([]byte{0xAB}, 40)
+	redundant := bytes.Repeat([]byte{0xCD}, 260)
+
+	testCases := []struct {
+		name     string
+		mimeType string
+		payload  []byte
+		want     bool
+	}{
+		{"opus frame", webrtc.MimeTypeOpus, opusFrame, false},
+		{"opus dtx toc only", webrtc.MimeTypeOpus, []byte{0x78}, true},
+		{"opus dtx two bytes", webrtc.MimeTypeOpus, []byte{0x78, 0x00}, true},
+		{"opus three bytes", webrtc.MimeTypeOpus, []byte{0x78, 0x00, 0x00}, false},
+		{"mime type is case insensitive", "AUDIO/OPUS", []byte{0x78}, true},
+		{"not audio", webrtc.MimeTypeVP8, []byte{0x10}, false},
+
+		// RED (RFC 2198): 4 byte headers with the F bit set for the redundant
+		// blocks, a 14 bit timestamp offset and a 10 bit block length, then a
+		// 1 byte header for the primary encoding
+		{"red without redundancy", mimeTypeRED, append([]byte{0x6F}, opusFrame...), false},
+		{"red dtx without redundancy", mimeTypeRED, []byte{0x6F, 0x78}, true},
+		{
+			"red dtx after one block",
+			mimeTypeRED,
+			append(append([]byte{0xEF, 0x03, 0xC0, 0x28, 0x6F}, opusFrame...), 0x78),
+			true,
+		},
+		{
+			"red frame after one block",
+			mimeTypeRED,
+			append(append([]byte{0xEF, 0x03, 0xC0, 0x28, 0x6F}, opusFrame...), opusFrame...),
+			false,
+		},
+		{
+			"red dtx after two blocks",
+			mimeTypeRED,
+			append(append(append([]byte{0xEF, 0x07, 0x80, 0x28, 0xEF, 0x03, 0xC0, 0x28, 0x6F}, opusFrame...), opusFrame...), 0x78),
+			true,
+		},
+		{
+			"red block length uses 10 bits",
+			mimeTypeRED,
+			append(append([]byte{0xEF, 0xFF, 0xFD, 0x04, 0x6F}, redundant...), 0x78),
+			true,
+		},
+		{"red empty", mimeTypeRED, []byte{}, false},
+		{"red truncated block header", mimeTypeRED, []byte{0xEF, 0x03, 0xC0}, false},
+		{"red missing primary header", mimeTypeRED, []byte{0xEF, 0x03, 0xC0, 0x28}, false},
+		{"red block longer than the payload", mimeTypeRED, []byte{0xEF, 0x03, 0xC0, 0x28, 0x6F, 0x78}, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := IsDTX(tc.mimeType, tc.payload); got != tc.want {
+				t.Errorf("IsDTX(%s, %d bytes) = %v, want %v", tc.mimeType, len(tc.payload), got, tc.want)
+			}
+		})
+	}
+}
+
+// newTestVoiceDetector starts a detector with short margins and returns a
+// function waiting for a voice activity, or for none when want is empty.
+func newTestVoiceDetector(t *testing.T, config Config) (*VoiceDetector, func(want VoiceActivityType, timeout time.Duration)) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	v := newVAD(ctx, config, 1, nil, logging.NewDefaultLoggerFactory().NewLogger("vad"))
+	t.Cleanup(v.Stop)
+
+	activities := make(chan VoiceActivityType, 16)
+	v.OnVoiceDetected(func(activity VoiceActivity) {
+		activities <- activity.Type
+	})
+
+	waitFor := func(want VoiceActivityType, timeout time.Duration) {
+		t.Helper()
+
+		deadline := time.After(timeout)
+
+		for {
+			select {
+			case got := <-activities:
+				if got == want {
+					return
+				}
+
+				if want == "" && got != VoiceActivityActive {
+					t.Fatalf("unexpected %s voice activity", got)
+				}
+			case <-deadline:
+				if want != "" {
+					t.Fatalf("no %s voice activity after %s", want, timeout)
+				}
+
+				return
+			}
+		}
+	}
+
+	return v, waitFor
+}
+
+func newTestDTXConfig() Config {
+	config := DefaultConfig()
+	config.Interval = 10 * time.Millisecond
+	config.HeadMargin = 0
+	config.TailMargin = 5 * time.Second
+	config.DTXGap = 50 * time.Millisecond
+
+	return config
+}
+
+func TestVoiceDetectorDTXGapEndsVoice(t *testing.T) {
+	v, waitFor := newTestVoiceDetector(t, newTestDTXConfig())
+
+	// a DTX frame before the speech tells the stream uses DTX
+	v.markPacket(true)
+	v.addPacket(&rtp.Header{SequenceNumber: 0}, audioLevelSilence, false, true)
+
+	for i := 1; i < 5; i++ {
+		v.markPacket(false)
+		v.addPacket(&rtp.Header{SequenceNumber: uint16(i)}, 10, true, false)
+	}
+
+	waitFor(VoiceActivityStarted, time.Second)
+
+	// the stream goes quiet without sending a DTX frame, the tail margin is much
+	// longer so only the gap can end the voice
+	waitFor(VoiceActivityEnded, time.Second)
+}
+
+func TestVoiceDetectorGapWithoutDTX(t *testing.T) {
+	v, waitFor := newTestVoiceDetector(t, newTestDTXConfig())
+
+	for i := 0; i < 5; i++ {
+		v.markPacket(false)
+		v.addPacket(&rtp.Header{SequenceNumber: uint16(i)}, 10, true, false)
+	}
+
+	waitFor(VoiceActivityStarted, time.Second)
+
+	// jitter on a stream that never sent a DTX frame doesn't end the voice
+	waitFor("", 200*time.Millisecond)
+}
+
+func TestInterceptorDTXFrameEndsVoice(t *testing.T) {
+	config := newTestDTXConfig()
+	config.DTXGap = 0
+
+	v, waitFor := newTestVoiceDetector(t, config)
+
+	i := &Interceptor{
+		vads: map[uint32]*VoiceDetector{1: v},
+		log:  logging.NewDefaultLoggerFactory().NewLogger("vad"),
+	}
+
+	v.addPacket(&rtp.Header{SequenceNumber: 0}, 10, true, false)
+	waitFor(VoiceActivityStarted, time.Second)
+
+	level, ok := i.processPacket(1, &rtp.Header{SequenceNumber: 1}, true)
+	if !ok || level.Level != audioLevelSilence || level.Voice {
+		t.Errorf("level of a DTX frame = %+v, %v, want silence", level, ok)
+	}
+
+	if !v.usesDTX.Load() {
+		t.Error("the stream should be marked as using DTX")
+	}
+
+	waitFor(VoiceActivityEnded, time.Second)
+
+	if _, ok := i.processPacket(2, &rtp.Header{}, true); ok {
+		t.Error("a packet of an unknown stream shouldn't have a level")
+	}
+}
@@ -2,7 +2,6 @@ package voiceactivedetector
 
 import (
 	"context"
-	"log"
 	"sync"
 	"time"
 
@@ -26,14 +25,31 @@ type Config struct {
 	HeadMargin time.Duration
 	TailMargin time.Duration
 	Threshold  uint8
+	// Adaptive replaces the fixed threshold with one that follows the noise floor
+	// of each stream, a packet is voice when it is NoiseFloorMargin dB louder than
+	// the noise floor.
+	Adaptive         bool
+	NoiseFloorMargin uint8
+	// Hysteresis is how many dB quieter than the threshold a packet can be and
+	// still keep an active voice going, so a level around the threshold doesn't
+	// start and end the activity on every packet.
+	Hysteresis uint8
+	// DTXGap ends the voice activity when the stream sends no packet for this long,
+	// Opus DTX streams go quiet in silence instead of sending silent frames. It
+	// only applies once the stream sent a DTX frame.
+	DTXGap time.Duration
 }
 
 func DefaultConfig() Config {
 	return Config{
-		Interval:   100 * time.Millisecond,
-		HeadMargin: 200 * time.Millisecond,
-		TailMargin: 300 * time.Millisecond,
-		Threshold:  40,
+		Interval:         100 * time.Millisecond,
+		HeadMargin:       200 * time.Millisecond,
+		TailMargin:       300 * time.Millisecond,
+		Threshold:        40,
+		Adaptive:         false,
+		NoiseFloorMargin: 20,
+		Hysteresis:       6,
+		DTXGap:           150 * time.Millisecond,
 	}
 }
 
@@ -99,24 +115,23 @@ func (v *Interceptor) UnbindLocalStream(info *interceptor.StreamInfo) {
 }
 
 func (v *Interceptor) BindRemoteStream(info *interceptor.StreamInfo, reader interceptor.RTPReader) interceptor.RTPReader {
-	log.Println("stream received: ", info.SSRC)
-	if info.MimeType != webrtc.MimeTypeOpus && info.MimeType != "audio/red" {
+	if info.MimeType != webrtc.MimeTypeOpus && info.MimeType != mimeTypeRED {
 		return reader
 	}
 
-	vad := v.getVadBySSRC(info.SSRC)
-	if vad != nil {
-		vad.updateStreamInfo(info)
-	}
+	v.log.Debugf("vad: audio stream %d received", info.SSRC)
 
-	if vad == nil {
-		v.vads[info.SSRC] = newVAD(v.context, v.config, info)
-		vad = v.vads[info.SSRC]
-	}
+	vad := v.getOrCreateVAD(info.SSRC)
+	vad.updateStreamInfo(info)
 
-	if v.onNew != nil {
-		v.onNew(vad)
+	v.mu.RLock()
+	onNew := v.onNew
+	v.mu.RUnlock()
+
+	if onNew != nil {
+		onNew(vad)
 	}
+
 	return interceptor.RTPReaderFunc(func(b []byte, a interceptor.Attributes) (int, interceptor.Attributes, error) {
 		i, attr, err := reader.Read(b, a)
 		if err != nil {
@@ -132,10 +147,21 @@ func (v *Interceptor) BindRemoteStream(info *interceptor.StreamInfo, reader inte
 			return 0, nil, err
 		}
 
-		audioAttribute := v.processPacket(info.SSRC, header)
+		payload := b[:i]
+		if header.MarshalSize() <= len(payload) {
+			payload = payload[header.MarshalSize():]
+		}
+
+		if header.Padding && len(payload) > 0 {
+			payload = payload[:max(len(payload)-int(payload[len(payload)-1]), 0)]
+		}
 
-		attr.Set(ATTRIBUTE_KEY, audioAttribute.Level)
-		attr.Set("isVoice", audioAttribute.Voice)
+		// without a level the attribute is left unset, a zero level is 0 dBov and
+		// would rank the stream as the loudest one
+		if audioAttribute, ok := v.processPacket(info.SSRC, header, IsDTX(info.MimeType, payload)); ok {
+			attr.Set(ATTRIBUTE_KEY, audioAttribute.Level)
+			attr.Set("isVoice", audioAttribute.Voice)
+		}
 
 		return i, attr, nil
 	})
@@ -164,42 +190,66 @@ func (v *Interceptor) BindRTCPWriter(writer interceptor.RTCPWriter) interceptor.
 	return writer
 }
 
-func (v *Interceptor) processPacket(ssrc uint32, header *rtp.Header) rtp.AudioLevelExtension {
-	audioData := v.getAudioLevel(ssrc, header)
-	log.Println(audioData)
+// processPacket reports false when the packet has no audio level.
+func (v *Interceptor) processPacket(ssrc uint32, header *rtp.Header, dtx bool) (rtp.AudioLevelExtension, bool) {
+	vad := v.getVadBySSRC(ssrc)
+	if vad == nil {
+		v.log.Tracef("vad: not found for track ssrc %d", ssrc)
+		return rtp.AudioLevelExtension{}, false
+	}
+
+	vad.markPacket(dtx)
 
-	if audioData.Level == 0 {
-		return rtp.AudioLevelExtension{}
+	if dtx {
+		vad.addPacket(header, audioLevelSilence, false, true)
+		return rtp.AudioLevelExtension{Level: audioLevelSilence}, true
 	}
 
-	vad := v.getVadBySSRC(ssrc)
-	if vad == nil {
-		log.Println("vad: not found for track ssrc", ssrc)
-		return rtp.AudioLevelExtension{}
+	audioData, ok := v.getAudioLevel(vad, header)
+	if !ok {
+		return rtp.AudioLevelExtension{}, false
+	}
+
+	// the adaptive threshold needs the silent packets to track the noise floor
+	if audioData.Voice || vad.config.Adaptive {
+		vad.addPacket(header, audioData.Level, audioData.Voice, false)
 	}
 
-	if audioData.Voice {
-		vad.addPacket(header, audioData.Level, audioData.Voice)
+	return audioData, true
+}
+
+// Thresholds returns the current voice threshold of every stream by SSRC.
+func (v *Interceptor) Thresholds() map[uint32]uint8 {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	thresholds := make(map[uint32]uint8, len(v.vads))
+	for ssrc, vad := range v.vads {
+		thresholds[ssrc] = vad.Threshold()
 	}
-	return audioData
+
+	return thresholds
 }
 
-func (v *Interceptor) getAudioLevel(ssrc uint32, header *rtp.Header) rtp.AudioLevelExtension {
+func (v *Interceptor) getAudioLevel(vad *VoiceDetector, header *rtp.Header) (rtp.AudioLevelExtension, bool) {
 	audioLevel := rtp.AudioLevelExtension{}
-	headerID := v.getAudioLevelExtensionID(ssrc)
+	headerID := vad.audioLevelExtensionID()
 
 	if headerID == 0 {
-		return audioLevel
+		return audioLevel, false
 	}
 
 	ext := header.GetExtension(headerID)
 	if ext == nil {
-		return audioLevel
+		return audioLevel, false
+	}
+
+	if err := audioLevel.Unmarshal(ext); err != nil {
+		v.log.Tracef("vad: invalid audio level extension: %s", err.Error())
+		return audioLevel, false
 	}
 
-	_ = audioLevel.Unmarshal(ext)
-	log.Printf("audio level: %v", audioLevel)
-	return audioLevel
+	return audioLevel, true
 }
 
 func (v *Interceptor) getVadBySSRC(ssrc uint32) *VoiceDetector {
@@ -213,33 +263,30 @@ func (v *Interceptor) getVadBySSRC(ssrc uint32) *VoiceDetector {
 	return nil
 }
 
-func (v *Interceptor) getAudioLevelExtensionID(ssrc uint32) uint8 {
-	vad := v.getVadBySSRC(ssrc)
-	if vad != nil {
-		for _, extension := range vad.streamInfo.RTPHeaderExtensions {
-			if extension.URI == sdp.AudioLevelURI {
-				return uint8(extension.ID)
-			}
-		}
+func (v *Interceptor) getOrCreateVAD(ssrc uint32) *VoiceDetector {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	vad, ok := v.vads[ssrc]
+	if !ok {
+		vad = newVAD(v.context, v.config, ssrc, nil, v.log)
+		v.vads[ssrc] = vad
 	}
-	return 0
+
+	return vad
 }
 
+// MapAudioTrack returns the detector of the track's stream, the stream may not be
+// bound yet when the track is received so the detector is created if needed.
 func (v *Interceptor) MapAudioTrack(ssrc uint32, t *webrtc.TrackRemote) *VoiceDetector {
 	if t.Kind() != webrtc.RTPCodecTypeAudio {
-		log.Println("vad: track is not audio track")
+		v.log.Debugf("vad: track %s is not an audio track", t.ID())
 		return nil
 	}
 
-	vad := v.getVadBySSRC(ssrc)
-	if vad == nil {
-		vad = newVAD(v.context, v.config, nil)
-		v.mu.Lock()
-		v.vads[ssrc] = vad
-		v.mu.Unlock()
-	}
-
+	vad := v.getOrCreateVAD(ssrc)
 	vad.UpdateTrack(t.ID(), t.StreamID())
+
 	return vad
 }
 
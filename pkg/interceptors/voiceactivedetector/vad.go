@@ -3,11 +3,19 @@ package voiceactivedetector
 import (
 	"context"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pion/interceptor"
 	"github.com/pion/logging"
 	"github.com/pion/rtp"
+	"github.com/pion/sdp/v3"
+)
+
+const (
+	audioLevelSilence  = 127
+	noiseFloorFallRate = 0.05
+	noiseFloorRiseRate = 0.0005
 )
 
 type VoicePacketData struct {
@@ -15,9 +23,21 @@ type VoicePacketData struct {
 	Timestamp  uint32 `json:"timestamp"`
 	AudioLevel uint8  `json:"audioLevel"`
 	IsVoice    bool   `json:"isVoice"`
+	IsDTX      bool   `json:"isDTX"`
 }
 
+type VoiceActivityType string
+
+const (
+	VoiceActivityStarted VoiceActivityType = "started"
+	// VoiceActivityActive is emitted every interval while the voice is active
+	// with the audio levels of the interval
+	VoiceActivityActive VoiceActivityType = "active"
+	VoiceActivityEnded  VoiceActivityType = "ended"
+)
+
 type VoiceActivity struct {
+	Type        VoiceActivityType `json:"type"`
 	TrackID     string            `json:"trackID"`
 	StreamID    string            `json:"streamID"`
 	SSRC        uint32            `json:"ssrc"`
@@ -26,6 +46,7 @@ type VoiceActivity struct {
 }
 
 type VoiceDetector struct {
+	ssrc         uint32
 	streamInfo   *interceptor.StreamInfo
 	config       Config
 	streamID     string
@@ -35,19 +56,26 @@ type VoiceDetector struct {
 	channel      chan VoicePacketData
 	mu           sync.RWMutex
 	VoicePackets []VoicePacketData
-	callback     func([]VoicePacketData)
+	callbacks    []func(VoiceActivity)
+	lastPacketAt atomic.Int64
+	usesDTX      atomic.Bool
+	noiseFloor   float64
+	threshold    uint8
 	log          logging.LeveledLogger
 }
 
-func newVAD(ctx context.Context, config Config, streamInfo *interceptor.StreamInfo) *VoiceDetector {
+func newVAD(ctx context.Context, config Config, ssrc uint32, streamInfo *interceptor.StreamInfo, log logging.LeveledLogger) *VoiceDetector {
 	v := &VoiceDetector{
 		context:      ctx,
 		config:       config,
+		ssrc:         ssrc,
 		streamInfo:   streamInfo,
 		channel:      make(chan VoicePacketData, 1024),
 		mu:           sync.RWMutex{},
 		VoicePackets: make([]VoicePacketData, 0),
-		log:          logging.NewDefaultLoggerFactory().NewLogger("vad"),
+		threshold:    config.Threshold,
+		callbacks:    make([]func(VoiceActivity), 0),
+		log:          log,
 	}
 
 	v.run()
@@ -56,103 +84,270 @@ func newVAD(ctx context.Context, config Config, streamInfo *interceptor.StreamIn
 }
 
 func (v *VoiceDetector) SSRC() uint32 {
-	return v.streamInfo.SSRC
+	return v.ssrc
 }
 
 func (v *VoiceDetector) run() {
-	go func() {
-		ticker := time.NewTicker(v.config.TailMargin)
-		ctx, cancel := context.WithCancel(v.context)
+	ctx, cancel := context.WithCancel(v.context)
+	v.cancel = cancel
 
-		v.cancel = cancel
+	headMargin := time.Duration(0)
+	if v.config.Adaptive {
+		headMargin = v.config.HeadMargin
+	}
 
-		bufferTicker := time.NewTicker(v.config.Interval)
+	go func() {
+		ticker := time.NewTicker(v.config.Interval)
 
 		defer func() {
-			bufferTicker.Stop()
 			ticker.Stop()
 			cancel()
 		}()
 
 		active := false
 		lastSent := time.Now()
+		voiceSince := time.Time{}
+
+		buffer := make([]VoicePacketData, 0, 1024)
+		// voice packets seen before the head margin is reached
+		pending := make([]VoicePacketData, 0, 1024)
 
-		buffer := make([]VoicePacketData, 1024)
-		bufferLength := 0
+		end := func() {
+			voiceSince = time.Time{}
+			pending = pending[:0]
+
+			if !active {
+				return
+			}
+
+			if len(buffer) > 0 {
+				voicePackets := make([]VoicePacketData, len(buffer))
+				copy(voicePackets, buffer)
+
+				v.onVoiceDetected(VoiceActivityActive, voicePackets)
+				buffer = buffer[:0]
+			}
+
+			v.onVoiceDetected(VoiceActivityEnded, nil)
+			active = false
+		}
 
 		for {
 			select {
 			case <-ctx.Done():
 				return
-			case <-bufferTicker.C:
-				voicePackets := make([]VoicePacketData, bufferLength)
+			case <-ticker.C:
+				// only a stream that sent a DTX frame goes quiet in silence, on the
+				// others a gap is jitter or loss and the tail margin ends the voice
+				if active && v.config.DTXGap > 0 && v.usesDTX.Load() && v.sincePacket() > v.config.DTXGap {
+					end()
+					continue
+				}
+
+				if time.Since(lastSent) > v.config.TailMargin {
+					end()
+					continue
+				}
+
+				if len(buffer) == 0 {
+					continue
+				}
+
+				voicePackets := make([]VoicePacketData, len(buffer))
 				copy(voicePackets, buffer)
 
-				v.onVoiceDetected(voicePackets)
+				v.onVoiceDetected(VoiceActivityActive, voicePackets)
 				buffer = buffer[:0]
-				bufferLength = 0
 			case voicePacket := <-v.channel:
-				if voicePacket.AudioLevel < v.config.Threshold {
-					buffer = append(buffer, voicePacket)
-					bufferLength++
-					lastSent = time.Now()
-					active = true
+				// the encoder already decided the speech is over
+				if voicePacket.IsDTX {
+					end()
+					continue
 				}
-			case <-ticker.C:
-				if active && time.Since(lastSent) > v.config.TailMargin {
-					v.onVoiceDetected(nil)
-					active = false
+
+				if !v.isVoice(voicePacket, active) {
+					continue
+				}
+
+				now := time.Now()
+				lastSent = now
+
+				if !active {
+					if voiceSince.IsZero() {
+						voiceSince = now
+					}
+
+					if now.Sub(voiceSince) < headMargin {
+						pending = append(pending, voicePacket)
+						continue
+					}
+
+					active = true
+					v.onVoiceDetected(VoiceActivityStarted, nil)
+
+					buffer = append(buffer, pending...)
+					pending = pending[:0]
 				}
+
+				buffer = append(buffer, voicePacket)
 			}
 		}
 	}()
 }
 
-func (v *VoiceDetector) onVoiceDetected(pkts []VoicePacketData) {
+// isVoice tells if the packet starts a voice activity, or keeps it going when
+// active with the threshold lowered by the hysteresis.
+func (v *VoiceDetector) isVoice(pkt VoicePacketData, active bool) bool {
+	if !v.config.Adaptive {
+		return isAboveThreshold(pkt.AudioLevel, v.config.Threshold, v.config.Hysteresis, active)
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	// the level is in -dBov so a higher level is quieter. The floor follows a
+	// quieter background quickly and a louder one slowly, so speech doesn't
+	// raise it much while a noisy room does over time.
+	level := float64(pkt.AudioLevel)
+	if v.noiseFloor == 0 {
+		v.noiseFloor = level
+	} else if level > v.noiseFloor {
+		v.noiseFloor += (level - v.noiseFloor) * noiseFloorFallRate
+	} else {
+		v.noiseFloor += (level - v.noiseFloor) * noiseFloorRiseRate
+	}
+
+	v.threshold = uint8(max(v.noiseFloor-float64(v.config.NoiseFloorMargin), 0))
+
+	// the stop threshold stays at least half the margin above the noise floor,
+	// otherwise the background alone would keep the voice active
+	hysteresis := min(v.config.Hysteresis, v.config.NoiseFloorMargin/2)
+
+	return isAboveThreshold(pkt.AudioLevel, v.threshold, hysteresis, active)
+}
+
+func isAboveThreshold(level, threshold, hysteresis uint8, active bool) bool {
+	if active {
+		return int(level) < int(threshold)+int(hysteresis)
+	}
+
+	return level < threshold
+}
+
+// Threshold returns the audio level under which a packet is considered voice.
+func (v *VoiceDetector) Threshold() uint8 {
+	if !v.config.Adaptive {
+		return v.config.Threshold
+	}
+
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	return v.threshold
+}
+
+// NoiseFloor returns the estimated background level of the stream, it is only
+// tracked in adaptive mode.
+func (v *VoiceDetector) NoiseFloor() uint8 {
 	v.mu.RLock()
 	defer v.mu.RUnlock()
 
-	if v.callback != nil {
-		v.callback(pkts)
+	return uint8(v.noiseFloor)
+}
+
+func (v *VoiceDetector) onVoiceDetected(activityType VoiceActivityType, pkts []VoicePacketData) {
+	v.mu.RLock()
+	callbacks := v.callbacks
+
+	activity := VoiceActivity{
+		Type:        activityType,
+		TrackID:     v.trackID,
+		StreamID:    v.streamID,
+		SSRC:        v.ssrc,
+		AudioLevels: pkts,
+	}
+
+	if v.streamInfo != nil {
+		activity.ClockRate = v.streamInfo.ClockRate
+	}
+	v.mu.RUnlock()
+
+	for _, callback := range callbacks {
+		callback(activity)
 	}
 }
 
-func (v *VoiceDetector) OnVoiceDetected(callback func([]VoicePacketData)) {
+func (v *VoiceDetector) OnVoiceDetected(callback func(VoiceActivity)) {
 	if v == nil {
 		return
 	}
-	v.mu.RLock()
-	defer v.mu.RUnlock()
 
-	v.callback = callback
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.callbacks = append(v.callbacks, callback)
+}
+
+func (v *VoiceDetector) markPacket(dtx bool) {
+	v.lastPacketAt.Store(time.Now().UnixNano())
+
+	if dtx {
+		v.usesDTX.Store(true)
+	}
 }
 
-func (v *VoiceDetector) addPacket(header *rtp.Header, audioLevel uint8, isVoice bool) {
+func (v *VoiceDetector) sincePacket() time.Duration {
+	return time.Since(time.Unix(0, v.lastPacketAt.Load()))
+}
+
+func (v *VoiceDetector) addPacket(header *rtp.Header, audioLevel uint8, isVoice, isDTX bool) {
 	vp := VoicePacketData{
 		SequenceNo: header.SequenceNumber,
 		Timestamp:  header.Timestamp,
 		AudioLevel: audioLevel,
 		IsVoice:    isVoice,
+		IsDTX:      isDTX,
 	}
 
-	v.channel <- vp
+	select {
+	case v.channel <- vp:
+	default:
+		v.log.Tracef("vad: dropped audio level of ssrc %d, detector is behind", v.ssrc)
+	}
 }
 
 func (v *VoiceDetector) UpdateTrack(trackID, streamID string) {
-	v.mu.RLock()
-	defer v.mu.RUnlock()
+	v.mu.Lock()
+	defer v.mu.Unlock()
 
 	v.trackID = trackID
 	v.streamID = streamID
 }
 
+func (v *VoiceDetector) audioLevelExtensionID() uint8 {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	if v.streamInfo == nil {
+		return 0
+	}
+
+	for _, extension := range v.streamInfo.RTPHeaderExtensions {
+		if extension.URI == sdp.AudioLevelURI {
+			return uint8(extension.ID)
+		}
+	}
+
+	return 0
+}
+
 func (v *VoiceDetector) Stop() {
 	v.cancel()
 }
 
 func (v *VoiceDetector) updateStreamInfo(streamInfo *interceptor.StreamInfo) {
-	v.mu.RLock()
-	defer v.mu.RUnlock()
+	v.mu.Lock()
+	defer v.mu.Unlock()
 
 	v.streamInfo = streamInfo
 }
@@ -0,0 +1,103 @@
+package voiceactivedetector
+
+import (
+	"testing"
+)
+
+func TestVoiceDetectorFixedThreshold(t *testing.T) {
+	v := &VoiceDetector{config: Config{Threshold: 40, Hysteresis: 6}}
+
+	testCases := []struct {
+		name   string
+		level  uint8
+		active bool
+		want   bool
+	}{
+		{"louder than the threshold starts", 39, false, true},
+		{"at the threshold doesn't start", 40, false, false},
+		{"under the threshold keeps going", 45, true, true},
+		{"under the stop threshold ends", 46, true, false},
+		{"silence ends", audioLevelSilence, true, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := v.isVoice(VoicePacketData{AudioLevel: tc.level}, tc.active); got != tc.want {
+				t.Errorf("isVoice(%d, active %v) = %v, want %v", tc.level, tc.active, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestVoiceDetectorNoiseFloor(t *testing.T) {
+	v := &VoiceDetector{config: Config{Adaptive: true, NoiseFloorMargin: 20, Hysteresis: 6}}
+
+	feed := func(level uint8, count int) {
+		for i := 0; i < count; i++ {
+			v.isVoice(VoicePacketData{AudioLevel: level}, false)
+		}
+	}
+
+	feed(90, 100)
+
+	if floor := v.NoiseFloor(); floor != 90 {
+		t.Fatalf("noise floor = %d, want 90", floor)
+	}
+
+	if threshold := v.Threshold(); threshold != 70 {
+		t.Fatalf("threshold = %d, want 70", threshold)
+	}
+
+	if !v.isVoice(VoicePacketData{AudioLevel: 65}, false) {
+		t.Error("a level 25 dB over the noise floor should start the voice")
+	}
+
+	if v.isVoice(VoicePacketData{AudioLevel: 74}, false) {
+		t.Error("a level under the threshold shouldn't start the voice")
+	}
+
+	if !v.isVoice(VoicePacketData{AudioLevel: 74}, true) {
+		t.Error("a level within the hysteresis should keep the voice going")
+	}
+
+	if v.isVoice(VoicePacketData{AudioLevel: 82}, true) {
+		t.Error("a level close to the noise floor should end the voice")
+	}
+
+	// speech barely moves the floor
+	feed(30, 100)
+
+	if floor := v.NoiseFloor(); floor < 85 {
+		t.Errorf("noise floor = %d after speech, want at least 85", floor)
+	}
+
+	// a quieter room lowers the floor quickly
+	feed(110, 100)
+
+	if floor := v.NoiseFloor(); floor < 105 {
+		t.Errorf("noise floor = %d after a quiet background, want at least 105", floor)
+	}
+
+	// a noisy room raises it over time
+	feed(60, 10000)
+
+	if floor := v.NoiseFloor(); floor > 65 {
+		t.Errorf("noise floor = %d after a noisy background, want at most 65", floor)
+	}
+
+	if v.isVoice(VoicePacketData{AudioLevel: 60}, false) {
+		t.Error("the noisy background shouldn't be voice")
+	}
+}
+
+func TestVoiceDetectorHysteresisStaysOverTheNoiseFloor(t *testing.T) {
+	v := &VoiceDetector{config: Config{Adaptive: true, NoiseFloorMargin: 10, Hysteresis: 20}}
+
+	for i := 0; i < 100; i++ {
+		v.isVoice(VoicePacketData{AudioLevel: 80}, false)
+	}
+
+	if v.isVoice(VoicePacketData{AudioLevel: 80}, true) {
+		t.Error("the noise floor shouldn't keep the voice going")
+	}
+}
@@ -0,0 +1,232 @@
+package signaling
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gautam24s/meetup"
+	"github.com/pion/logging"
+	"github.com/pion/webrtc/v4"
+)
+
+const (
+	contentTypeSDP            = "application/sdp"
+	contentTypeTrickleICE     = "application/trickle-ice-sdpfrag"
+	maxSessionDescriptionSize = 1 << 20
+	// the resource ID is the only credential of the PATCH and DELETE requests
+	resourceIDLength = 32
+)
+
+var ErrNoSupportedMedia = errors.New("signaling: error offer has no media the room supports")
+
+// resources are the clients created by the WHIP and WHEP handlers, they serve the
+// PATCH and DELETE requests of the resource URL. A resource is named by a random
+// ID rather than the client ID, which other clients of the room can see.
+type resources struct {
+	mu      sync.Mutex
+	clients map[string]*meetup.Client
+	log     logging.LeveledLogger
+}
+
+func newResources(log logging.LeveledLogger) *resources {
+	return &resources{
+		mu:      sync.Mutex{},
+		clients: make(map[string]*meetup.Client),
+		log:     log,
+	}
+}
+
+func (res *resources) add(roomID string, client *meetup.Client) string {
+	resourceID := meetup.GenerateID(resourceIDLength)
+	key := roomID + "/" + resourceID
+
+	res.mu.Lock()
+	res.clients[key] = client
+	res.mu.Unlock()
+
+	client.OnLeft(func() {
+		res.mu.Lock()
+		defer res.mu.Unlock()
+
+		delete(res.clients, key)
+	})
+
+	return resourceID
+}
+
+func (res *resources) get(roomID, resourceID string) (*meetup.Client, bool) {
+	res.mu.Lock()
+	defer res.mu.Unlock()
+
+	client, ok := res.clients[roomID+"/"+resourceID]
+
+	return client, ok
+}
+
+func (res *resources) trickle(w http.ResponseWriter, r *http.Request) {
+	client, ok := res.get(r.PathValue("room"), r.PathValue("resource"))
+	if !ok {
+		http.Error(w, "resource not found", http.StatusNotFound)
+		return
+	}
+
+	addTrickleCandidates(w, r, client)
+}
+
+func (res *resources) stop(w http.ResponseWriter, r *http.Request) {
+	client, ok := res.get(r.PathValue("room"), r.PathValue("resource"))
+	if !ok {
+		http.Error(w, "resource not found", http.StatusNotFound)
+		return
+	}
+
+	if err := client.Stop(); err != nil && !errors.Is(err, meetup.ErrClientStopped) {
+		res.log.Errorf("signaling: error stopping client %s: %s", client.ID(), err.Error())
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// writeAnswer replies 201 with the answer and the resource URL, built from the
+// request URI so it stays valid behind http.StripPrefix.
+func (res *resources) writeAnswer(w http.ResponseWriter, r *http.Request, resourceID string, answer *webrtc.SessionDescription) {
+	path := strings.SplitN(r.RequestURI, "?", 2)[0]
+
+	w.Header().Set("Content-Type", contentTypeSDP)
+	w.Header().Set("Location", strings.TrimSuffix(path, "/")+"/"+resourceID)
+	w.WriteHeader(http.StatusCreated)
+
+	if _, err := io.WriteString(w, answer.SDP); err != nil {
+		res.log.Errorf("signaling: error writing answer: %s", err.Error())
+	}
+}
+
+// bearerToken returns the join token of the Authorization header.
+func bearerToken(r *http.Request) string {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return ""
+	}
+
+	return strings.TrimSpace(token)
+}
+
+func readSessionDescription(w http.ResponseWriter, r *http.Request) (webrtc.SessionDescription, bool) {
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), contentTypeSDP) {
+		http.Error(w, "content type must be "+contentTypeSDP, http.StatusUnsupportedMediaType)
+		return webrtc.SessionDescription{}, false
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxSessionDescriptionSize))
+	if err != nil || len(body) == 0 {
+		http.Error(w, "invalid offer", http.StatusBadRequest)
+		return webrtc.SessionDescription{}, false
+	}
+
+	return webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: string(body)}, true
+}
+
+// negotiate answers the offer and checks that at least one media section was
+// accepted, a rejected section means the room doesn't support any of its codecs.
+func negotiate(client *meetup.Client, offer webrtc.SessionDescription) (*webrtc.SessionDescription, error) {
+	answer, err := client.Negotiate(offer)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := answer.Unmarshal()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, media := range parsed.MediaDescriptions {
+		if media.MediaName.Media != "application" && media.MediaName.Port.Value != 0 {
+			return answer, nil
+		}
+	}
+
+	return nil, ErrNoSupportedMedia
+}
+
+func addTrickleCandidates(w http.ResponseWriter, r *http.Request, client *meetup.Client) {
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), contentTypeTrickleICE) {
+		http.Error(w, "content type must be "+contentTypeTrickleICE, http.StatusUnsupportedMediaType)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxSessionDescriptionSize))
+	if err != nil {
+		http.Error(w, "invalid candidates", http.StatusBadRequest)
+		return
+	}
+
+	for _, candidate := range parseTrickleCandidates(string(body)) {
+		if err := client.AddICECandidate(candidate); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// parseTrickleCandidates reads the candidates of an SDP fragment (RFC 8840).
+func parseTrickleCandidates(fragment string) []webrtc.ICECandidateInit {
+	candidates := make([]webrtc.ICECandidateInit, 0)
+
+	var mid *string
+
+	for _, line := range strings.Split(fragment, "\n") {
+		line = strings.TrimSpace(line)
+
+		switch {
+		case strings.HasPrefix(line, "a=mid:"):
+			value := strings.TrimPrefix(line, "a=mid:")
+			mid = &value
+		case strings.HasPrefix(line, "a=candidate:"):
+			candidates = append(candidates, webrtc.ICECandidateInit{
+				Candidate: strings.TrimPrefix(line, "a="),
+				SDPMid:    mid,
+			})
+		}
+	}
+
+	return candidates
+}
+
+// writeNegotiationError replies to a failed negotiation, the client is stopped.
+func writeNegotiationError(w http.ResponseWriter, client *meetup.Client, err error) {
+	_ = client.Stop()
+
+	if errors.Is(err, ErrNoSupportedMedia) {
+		writeHTTPError(w, err)
+		return
+	}
+
+	http.Error(w, err.Error(), http.StatusBadRequest)
+}
+
+func writeHTTPError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, meetup.ErrRoomNotFound), errors.Is(err, ErrNoTracksAvailable):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, meetup.ErrRoomIsClosed):
+		http.Error(w, err.Error(), http.StatusGone)
+	case errors.Is(err, meetup.ErrRoomIsFull):
+		w.Header().Set("Retry-After", "30")
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	case errors.Is(err, meetup.ErrInvalidToken), errors.Is(err, meetup.ErrTokenExpired), errors.Is(err, meetup.ErrTokenMismatch):
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+	case errors.Is(err, meetup.ErrPermissionDenied), errors.Is(err, meetup.ErrClientBanned):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, meetup.ErrClientExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, ErrNoSupportedMedia):
+		http.Error(w, err.Error(), http.StatusNotAcceptable)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,221 @@
+package signaling
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gautam24s/meetup"
+)
+
+func TestWriteHTTPError(t *testing.T) {
+	testCases := []struct {
+		err  error
+		want int
+	}{
+		{meetup.ErrRoomNotFound, http.StatusNotFound},
+		{ErrNoTracksAvailable, http.StatusNotFound},
+		{meetup.ErrRoomIsClosed, http.StatusGone},
+		{meetup.ErrRoomIsFull, http.StatusServiceUnavailable},
+		{meetup.ErrInvalidToken, http.StatusUnauthorized},
+		{meetup.ErrTokenExpired, http.StatusUnauthorized},
+		{meetup.ErrTokenMismatch, http.StatusUnauthorized},
+		{meetup.ErrPermissionDenied, http.StatusForbidden},
+		{meetup.ErrClientBanned, http.StatusForbidden},
+		{meetup.ErrClientExists, http.StatusConflict},
+		{ErrNoSupportedMedia, http.StatusNotAcceptable},
+		{fmt.Errorf("join: %w", meetup.ErrRoomIsClosed), http.StatusGone},
+		{errors.New("unknown"), http.StatusInternalServerError},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.err.Error(), func(t *testing.T) {
+			w := httptest.NewRecorder()
+			writeHTTPError(w, tc.err)
+
+			if w.Code != tc.want {
+				t.Errorf("status = %d, want %d", w.Code, tc.want)
+			}
+		})
+	}
+
+	w := httptest.NewRecorder()
+	writeHTTPError(w, meetup.ErrRoomIsFull)
+
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("a full room should tell when to retry")
+	}
+}
+
+func TestParseTrickleCandidates(t *testing.T) {
+	fragment := "a=ice-ufrag:abcd\r\n" +
+		"a=ice-pwd:secret\r\n" +
+		"m=audio 9 UDP/TLS/RTP/SAVPF 111\r\n" +
+		"a=mid:0\r\n" +
+		"a=candidate:1 1 udp 2122260223 192.0.2.1 5000 typ host\r\n" +
+		"m=video 9 UDP/TLS/RTP/SAVPF 96\r\n" +
+		"a=mid:1\r\n" +
+		"a=candidate:2 1 udp 2122260223 192.0.2.1 5002 typ host\r\n" +
+		"a=end-of-candidates\r\n"
+
+	candidates := parseTrickleCandidates(fragment)
+	if len(candidates) != 2 {
+		t.Fatalf("candidates = %+v, want 2", candidates)
+	}
+
+	for i, want := range []struct{ candidate, mid string }{
+		{"candidate:1 1 udp 2122260223 192.0.2.1 5000 typ host", "0"},
+		{"candidate:2 1 udp 2122260223 192.0.2.1 5002 typ host", "1"},
+	} {
+		if candidates[i].Candidate != want.candidate || candidates[i].SDPMid == nil || *candidates[i].SDPMid != want.mid {
+			t.Errorf("candidate %d = %+v, want %s in mid %s", i, candidates[i], want.candidate, want.mid)
+		}
+	}
+}
+
+func postOffer(handler http.Handler, target, contentType, body, token string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	r.Header.Set("Content-Type", contentType)
+
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	return w
+}
+
+func TestWHIPStatusCodes(t *testing.T) {
+	manager := newTestManager(t)
+
+	full := meetup.DefaultRoomOptions()
+	full.MaxClients = 1
+	fullRoom := newTestRoom(t, manager, "full", full)
+
+	if _, err := fullRoom.AddClient("alice", "alice", meetup.DefaultClientOptions()); err != nil {
+		t.Fatal(err)
+	}
+
+	secured := meetup.DefaultRoomOptions()
+	secured.TokenKey = meetup.NewHMACTokenKey([]byte("secret"))
+	newTestRoom(t, manager, "secured", secured)
+
+	handler := NewWHIPHandler(manager, DefaultOptions())
+
+	testCases := []struct {
+		name        string
+		target      string
+		contentType string
+		body        string
+		token       string
+		want        int
+	}{
+		{"wrong content type", "/full", "application/json", "{}", "", http.StatusUnsupportedMediaType},
+		{"empty offer", "/full", contentTypeSDP, "", "", http.StatusBadRequest},
+		{"unknown room", "/unknown", contentTypeSDP, "v=0", "", http.StatusNotFound},
+		{"full room", "/full", contentTypeSDP, "v=0", "", http.StatusServiceUnavailable},
+		{"missing token", "/secured", contentTypeSDP, "v=0", "", http.StatusUnauthorized},
+		{"invalid token", "/secured", contentTypeSDP, "v=0", "invalid", http.StatusUnauthorized},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if w := postOffer(handler, tc.target, tc.contentType, tc.body, tc.token); w.Code != tc.want {
+				t.Errorf("status = %d %s, want %d", w.Code, w.Body.String(), tc.want)
+			}
+		})
+	}
+}
+
+func TestWHEPStatusCodes(t *testing.T) {
+	manager := newTestManager(t)
+	newTestRoom(t, manager, "empty", meetup.DefaultRoomOptions())
+
+	opts := DefaultOptions()
+	// viewers never create rooms
+	opts.AutoCreateRooms = true
+
+	handler := NewWHEPHandler(manager, opts)
+
+	if w := postOffer(handler, "/unknown", contentTypeSDP, "v=0", ""); w.Code != http.StatusNotFound {
+		t.Errorf("status of an unknown room = %d, want %d", w.Code, http.StatusNotFound)
+	}
+
+	if _, err := manager.GetRoom("unknown"); err == nil {
+		t.Error("a viewer shouldn't create the room")
+	}
+
+	if w := postOffer(handler, "/empty", contentTypeSDP, "v=0", ""); w.Code != http.StatusNotFound {
+		t.Errorf("status of a room without tracks = %d, want %d", w.Code, http.StatusNotFound)
+	}
+
+	room, _ := manager.GetRoom("empty")
+	if len(room.SFU().GetClients()) != 0 {
+		t.Error("the viewer of a room without tracks should be stopped")
+	}
+}
+
+func TestResourcesUseUnguessableIDs(t *testing.T) {
+	manager := newTestManager(t)
+	room := newTestRoom(t, manager, "room", meetup.DefaultRoomOptions())
+
+	client, err := room.AddClient("alice", "alice", meetup.DefaultClientOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := newResources(DefaultOptions().Log)
+	resourceID := res.add(room.ID(), client)
+
+	if resourceID == client.ID() || len(resourceID) != resourceIDLength {
+		t.Fatalf("resource ID = %q, want %d random characters", resourceID, resourceIDLength)
+	}
+
+	if other := res.add(room.ID(), client); other == resourceID {
+		t.Error("two resources share an ID")
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("PATCH /{room}/{resource}", res.trickle)
+	mux.HandleFunc("DELETE /{room}/{resource}", res.stop)
+
+	request := func(method, target string) int {
+		r := httptest.NewRequest(method, target, strings.NewReader(""))
+		r.Header.Set("Content-Type", contentTypeTrickleICE)
+
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+
+		return w.Code
+	}
+
+	// the client ID is known to the whole room, it doesn't name the resource
+	if code := request(http.MethodDelete, "/room/alice"); code != http.StatusNotFound {
+		t.Errorf("DELETE with the client ID = %d, want %d", code, http.StatusNotFound)
+	}
+
+	if code := request(http.MethodPatch, "/other/"+resourceID); code != http.StatusNotFound {
+		t.Errorf("PATCH in another room = %d, want %d", code, http.StatusNotFound)
+	}
+
+	if code := request(http.MethodPatch, "/room/"+resourceID); code != http.StatusNoContent {
+		t.Errorf("PATCH = %d, want %d", code, http.StatusNoContent)
+	}
+
+	if code := request(http.MethodDelete, "/room/"+resourceID); code != http.StatusOK {
+		t.Errorf("DELETE = %d, want %d", code, http.StatusOK)
+	}
+
+	if client.State() != meetup.ClientStateEnded {
+		t.Error("DELETE should stop the client")
+	}
+
+	if code := request(http.MethodDelete, "/room/"+resourceID); code != http.StatusNotFound {
+		t.Errorf("DELETE of a stopped resource = %d, want %d", code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,198 @@
+// Package signaling is a WebSocket signaling server for meetup rooms.
+//
+// Every message in both directions is a JSON object with a type, an optional
+// request id that the server echoes in its reply or error, and a data object:
+//
+//	{"type": "join", "id": "1", "data": {"room_id": "lobby", "name": "alice"}}
+//
+// Client to server messages:
+//
+//	join        {"room_id", "client_id"?, "name"?, "auto_subscribe"?, "token"?}
+//	            joins the room, creating it with the room kind of the server
+//	            options when the server allows it. The
+//	            token is required by rooms with a token key, the client ID
+//	            then comes from the token. The server replies with joined.
+//	offer       {"sdp"} the client offer, the server replies with answer.
+//	answer      {"sdp"} the answer to a renegotiate offer from the server,
+//	            sent with the id of the renegotiate message.
+//	candidate   {"candidate": RTCIceCandidateInit} a trickled ICE candidate.
+//	subscribe   {"tracks": [{"client_id", "track_id"}]} subscribes to tracks
+//	            when the client joined without auto subscribe.
+//	unsubscribe {"tracks": [{"client_id", "track_id"}]}
+//	get_metadata {"scope", "client_id"?, "since"?} the room metadata or the
+//	            metadata of a client. With since the server replies with the
+//	            changes after that revision, or with a snapshot when they are
+//	            not kept anymore. The server replies with metadata.
+//	set_metadata {"scope", "key", "value", "expected_version"?} changes a key of
+//	            the room metadata (moderators) or of the own client metadata, a
+//	            null value deletes it. With expected_version the change only
+//	            applies when the entry is still at that version, 0 for a
+//	            missing key, otherwise it fails with the metadata conflict
+//	            error. The server replies with metadata_set.
+//	leave       {} leaves the room and closes the connection.
+//
+// Server to client messages:
+//
+//	joined           {"room_id", "client_id", "waiting"?} waiting is true when
+//	                 the client is in the lobby until a moderator admits it,
+//	                 the internal data channel tells the admission.
+//	answer           {"sdp"}
+//	renegotiate      {"sdp"} a server offer, the client replies with answer.
+//	                 Only the answer to the last offer is accepted.
+//	candidate        {"candidate": RTCIceCandidateInit}
+//	tracks_available {"tracks": [TrackInfo]} tracks the client can subscribe to.
+//	track_muted      {"client_id", "track_id", "muted", "hard"}
+//	metadata         {"scope", "client_id"?, "revision", "entries"?, "changes"?}
+//	                 either entries, a snapshot of {"value", "version"} by
+//	                 key, or changes, the deltas after the requested revision.
+//	                 The other one is null.
+//	metadata_set     {"scope", "key", "version"} the new version of the entry.
+//	metadata_changed {"scope", "client_id"?, "revision", "key", "value",
+//	                 "version", "deleted"?} sent for every change, a client
+//	                 applies the changes above the revision of its snapshot.
+//	left             {"client_id", "reason"?}
+//	error            {"code", "message"}
+//
+// The client creates the "internal" data channel before its first offer, the
+// SFU uses it for the media control messages such as video sizes and layers.
+// Its messages are {"v", "type", "data"}, meetup.EncodeInternalMessage and
+// meetup.DecodeInternalMessage read and write them in Go.
+// A data channel with any other label is a room data channel such as a chat,
+// the SFU opens it on the other clients and relays its messages to them as
+// {"label", "client_id", "data", "binary"?, "time"}.
+package signaling
+
+import (
+	"encoding/json"
+
+	"github.com/gautam24s/meetup"
+	"github.com/pion/webrtc/v4"
+)
+
+const (
+	MessageTypeJoin            = "join"
+	MessageTypeJoined          = "joined"
+	MessageTypeOffer           = "offer"
+	MessageTypeAnswer          = "answer"
+	MessageTypeCandidate       = "candidate"
+	MessageTypeRenegotiate     = "renegotiate"
+	MessageTypeSubscribe       = "subscribe"
+	MessageTypeUnsubscribe     = "unsubscribe"
+	MessageTypeLeave           = "leave"
+	MessageTypeLeft            = "left"
+	MessageTypeTracksAvailable = "tracks_available"
+	MessageTypeTrackMuted      = "track_muted"
+	MessageTypeGetMetadata     = "get_metadata"
+	MessageTypeSetMetadata     = "set_metadata"
+	MessageTypeMetadata        = "metadata"
+	MessageTypeMetadataSet     = "metadata_set"
+	MessageTypeMetadataChanged = "metadata_changed"
+	MessageTypeError           = "error"
+)
+
+type ErrorCode int
+
+const (
+	ErrorCodeInvalidMessage      ErrorCode = 4000
+	ErrorCodeNotJoined           ErrorCode = 4001
+	ErrorCodeAlreadyJoined       ErrorCode = 4002
+	ErrorCodeUnauthorized        ErrorCode = 4003
+	ErrorCodeRoomNotFound        ErrorCode = 4004
+	ErrorCodePermissionDenied    ErrorCode = 4005
+	ErrorCodeClientExists        ErrorCode = 4009
+	ErrorCodeRoomClosed          ErrorCode = 4010
+	ErrorCodeRoomFull            ErrorCode = 4011
+	ErrorCodeBanned              ErrorCode = 4012
+	ErrorCodeNegotiationFailed   ErrorCode = 4020
+	ErrorCodeUnexpectedAnswer    ErrorCode = 4021
+	ErrorCodeSubscriptionFailed  ErrorCode = 4030
+	ErrorCodeMetadataConflict    ErrorCode = 4031
+	ErrorCodeUnknownMessageType  ErrorCode = 4040
+	ErrorCodeInternalServerError ErrorCode = 5000
+)
+
+type Message struct {
+	Type string          `json:"type"`
+	ID   string          `json:"id,omitempty"`
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+type JoinRequest struct {
+	RoomID        string `json:"room_id"`
+	ClientID      string `json:"client_id,omitempty"`
+	Name          string `json:"name,omitempty"`
+	AutoSubscribe *bool  `json:"auto_subscribe,omitempty"`
+	Token         string `json:"token,omitempty"`
+}
+
+type JoinedResponse struct {
+	RoomID   string `json:"room_id"`
+	ClientID string `json:"client_id"`
+	Waiting  bool   `json:"waiting,omitempty"`
+}
+
+type SessionDescription struct {
+	SDP string `json:"sdp"`
+}
+
+type Candidate struct {
+	Candidate webrtc.ICECandidateInit `json:"candidate"`
+}
+
+type SubscribeRequest struct {
+	Tracks []meetup.SubscribeRequest `json:"tracks"`
+}
+
+type TracksAvailable struct {
+	Tracks []meetup.TrackInfo `json:"tracks"`
+}
+
+type TrackMuted struct {
+	ClientID string `json:"client_id"`
+	TrackID  string `json:"track_id"`
+	Muted    bool   `json:"muted"`
+	Hard     bool   `json:"hard"`
+}
+
+type MetadataRequest struct {
+	Scope    string  `json:"scope"`
+	ClientID string  `json:"client_id,omitempty"`
+	Since    *uint64 `json:"since,omitempty"`
+}
+
+type Metadata struct {
+	Scope    string                          `json:"scope"`
+	ClientID string                          `json:"client_id,omitempty"`
+	Revision uint64                          `json:"revision"`
+	Entries  map[string]meetup.MetadataEntry `json:"entries"`
+	Changes  []meetup.MetadataChange         `json:"changes"`
+}
+
+type SetMetadataRequest struct {
+	Scope           string          `json:"scope"`
+	Key             string          `json:"key"`
+	Value           json.RawMessage `json:"value"`
+	ExpectedVersion *uint64         `json:"expected_version,omitempty"`
+}
+
+type MetadataSet struct {
+	Scope   string `json:"scope"`
+	Key     string `json:"key"`
+	Version uint64 `json:"version"`
+}
+
+type MetadataChanged struct {
+	Scope    string `json:"scope"`
+	ClientID string `json:"client_id,omitempty"`
+	meetup.MetadataChange
+}
+
+type Left struct {
+	ClientID string `json:"client_id"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+type Error struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+}
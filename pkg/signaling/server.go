@@ -0,0 +1,605 @@
+package signaling
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gautam24s/meetup"
+	"github.com/gorilla/websocket"
+	"github.com/pion/logging"
+	"github.com/pion/webrtc/v4"
+)
+
+var (
+	ErrRenegotiationTimeout = errors.New("signaling: error renegotiation answer timed out")
+	ErrSessionClosed        = errors.New("signaling: error session is closed")
+)
+
+type Options struct {
+	// AutoCreateRooms creates the room on the first join instead of failing with
+	// ErrorCodeRoomNotFound.
+	AutoCreateRooms      bool
+	RoomKind             string
+	RoomOptions          meetup.RoomOptions
+	ClientOptions        meetup.ClientOptions
+	RenegotiationTimeout time.Duration
+	CheckOrigin          func(r *http.Request) bool
+	Log                  logging.LeveledLogger
+}
+
+func DefaultOptions() Options {
+	return Options{
+		AutoCreateRooms:      false,
+		RoomKind:             meetup.RoomKindMeeting,
+		RoomOptions:          meetup.DefaultRoomOptions(),
+		ClientOptions:        meetup.DefaultClientOptions(),
+		RenegotiationTimeout: 10 * time.Second,
+		Log:                  logging.NewDefaultLoggerFactory().NewLogger("signaling"),
+	}
+}
+
+type Server struct {
+	mu       sync.Mutex
+	manager  *meetup.Manager
+	options  Options
+	upgrader websocket.Upgrader
+	sessions map[string]map[string]*session
+	log      logging.LeveledLogger
+}
+
+func NewServer(manager *meetup.Manager, opts Options) *Server {
+	if opts.Log == nil {
+		opts.Log = logging.NewDefaultLoggerFactory().NewLogger("signaling")
+	}
+
+	return &Server{
+		mu:       sync.Mutex{},
+		manager:  manager,
+		options:  opts,
+		upgrader: websocket.Upgrader{CheckOrigin: opts.CheckOrigin},
+		sessions: make(map[string]map[string]*session),
+		log:      opts.Log,
+	}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		s.log.Errorf("signaling: websocket upgrade error: %s", err.Error())
+		return
+	}
+
+	sess := newSession(s, conn)
+	sess.run()
+}
+
+func (s *Server) getRoom(req JoinRequest) (*meetup.Room, error) {
+	return getRoom(s.manager, s.options, req.RoomID)
+}
+
+// getRoom creates the missing rooms with the kind of the options when the server
+// allows it, a joining client can't pick the kind of the room.
+func getRoom(manager *meetup.Manager, opts Options, roomID string) (*meetup.Room, error) {
+	room, err := manager.GetRoom(roomID)
+	if err == nil || !opts.AutoCreateRooms {
+		return room, err
+	}
+
+	room, err = manager.NewRoom(roomID, roomID, opts.RoomKind, opts.RoomOptions)
+	if errors.Is(err, meetup.ErrRoomExists) {
+		return manager.GetRoom(roomID)
+	}
+
+	return room, err
+}
+
+func (s *Server) addSession(sess *session) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	roomID := sess.room.ID()
+
+	sessions, ok := s.sessions[roomID]
+	if !ok {
+		sessions = make(map[string]*session)
+		s.sessions[roomID] = sessions
+
+		// the room callbacks can't be removed so they are registered once per room
+		sess.room.SFU().OnTrackMuteChanged(func(track meetup.ITrack) {
+			s.broadcast(roomID, MessageTypeTrackMuted, TrackMuted{
+				ClientID: track.ClientID(),
+				TrackID:  track.ID(),
+				Muted:    track.IsMuted(),
+				Hard:     track.IsHardMuted(),
+			})
+		})
+
+		sess.room.Metadata().OnChange(func(change meetup.MetadataChange) {
+			s.broadcast(roomID, MessageTypeMetadataChanged, MetadataChanged{
+				Scope:          meetup.MetadataScopeRoom,
+				MetadataChange: change,
+			})
+		})
+
+		sess.room.OnRoomClosed(func(id string) {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+
+			delete(s.sessions, id)
+		})
+	}
+
+	sessions[sess.client.ID()] = sess
+}
+
+func (s *Server) removeSession(sess *session) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if sessions, ok := s.sessions[sess.room.ID()]; ok {
+		delete(sessions, sess.client.ID())
+	}
+}
+
+func (s *Server) broadcast(roomID, messageType string, data any) {
+	s.mu.Lock()
+	sessions := make([]*session, 0, len(s.sessions[roomID]))
+	for _, sess := range s.sessions[roomID] {
+		sessions = append(sessions, sess)
+	}
+	s.mu.Unlock()
+
+	for _, sess := range sessions {
+		if err := sess.send(messageType, "", data); err != nil {
+			s.log.Debugf("signaling: failed to send %s to %s: %s", messageType, sess.client.ID(), err.Error())
+		}
+	}
+}
+
+type session struct {
+	server        *Server
+	conn          *websocket.Conn
+	context       context.Context
+	cancel        context.CancelFunc
+	writeMu       sync.Mutex
+	mu            sync.Mutex
+	room          *meetup.Room
+	client        *meetup.Client
+	offers        uint64
+	pendingAnswer *pendingAnswer
+}
+
+// pendingAnswer is a server offer waiting for the client answer, the answer
+// must carry the id of the renegotiate message.
+type pendingAnswer struct {
+	id     string
+	answer chan webrtc.SessionDescription
+}
+
+func newSession(server *Server, conn *websocket.Conn) *session {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &session{
+		server:  server,
+		conn:    conn,
+		context: ctx,
+		cancel:  cancel,
+	}
+}
+
+func (s *session) run() {
+	defer s.close()
+
+	for {
+		_, data, err := s.conn.ReadMessage()
+		if err != nil {
+			s.server.log.Debugf("signaling: websocket read error: %s", err.Error())
+			return
+		}
+
+		msg := Message{}
+		if err := json.Unmarshal(data, &msg); err != nil {
+			s.sendError("", ErrorCodeInvalidMessage, err)
+			continue
+		}
+
+		if leave := s.handle(msg); leave {
+			return
+		}
+	}
+}
+
+func (s *session) close() {
+	s.cancel()
+
+	if client := s.getClient(); client != nil {
+		s.server.removeSession(s)
+
+		if err := client.Stop(); err != nil && !errors.Is(err, meetup.ErrClientStopped) {
+			s.server.log.Errorf("signaling: error stopping client %s: %s", client.ID(), err.Error())
+		}
+	}
+
+	_ = s.conn.Close()
+}
+
+func (s *session) getClient() *meetup.Client {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.client
+}
+
+// handle processes a client message and reports whether the session is over.
+func (s *session) handle(msg Message) bool {
+	if msg.Type != MessageTypeJoin && s.getClient() == nil {
+		s.sendError(msg.ID, ErrorCodeNotJoined, errors.New("join a room first"))
+		return false
+	}
+
+	switch msg.Type {
+	case MessageTypeJoin:
+		req := JoinRequest{}
+		if err := json.Unmarshal(msg.Data, &req); err != nil || req.RoomID == "" {
+			s.sendError(msg.ID, ErrorCodeInvalidMessage, errors.New("room_id is required"))
+			return false
+		}
+
+		s.join(msg.ID, req)
+	case MessageTypeOffer:
+		req := SessionDescription{}
+		if err := json.Unmarshal(msg.Data, &req); err != nil {
+			s.sendError(msg.ID, ErrorCodeInvalidMessage, err)
+			return false
+		}
+
+		answer, err := s.client.Negotiate(webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: req.SDP})
+		if err != nil {
+			s.sendError(msg.ID, ErrorCodeNegotiationFailed, err)
+			return false
+		}
+
+		s.reply(msg.ID, MessageTypeAnswer, SessionDescription{SDP: answer.SDP})
+	case MessageTypeAnswer:
+		req := SessionDescription{}
+		if err := json.Unmarshal(msg.Data, &req); err != nil {
+			s.sendError(msg.ID, ErrorCodeInvalidMessage, err)
+			return false
+		}
+
+		s.mu.Lock()
+		pending := s.pendingAnswer
+		if pending != nil && pending.id == msg.ID {
+			s.pendingAnswer = nil
+		}
+		s.mu.Unlock()
+
+		if pending == nil {
+			s.sendError(msg.ID, ErrorCodeUnexpectedAnswer, errors.New("no renegotiation in progress"))
+			return false
+		}
+
+		if pending.id != msg.ID {
+			s.sendError(msg.ID, ErrorCodeUnexpectedAnswer, errors.New("answer doesn't match the renegotiation in progress"))
+			return false
+		}
+
+		pending.answer <- webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: req.SDP}
+	case MessageTypeCandidate:
+		req := Candidate{}
+		if err := json.Unmarshal(msg.Data, &req); err != nil {
+			s.sendError(msg.ID, ErrorCodeInvalidMessage, err)
+			return false
+		}
+
+		if err := s.client.AddICECandidate(req.Candidate); err != nil {
+			s.sendError(msg.ID, ErrorCodeNegotiationFailed, err)
+		}
+	case MessageTypeSubscribe, MessageTypeUnsubscribe:
+		req := SubscribeRequest{}
+		if err := json.Unmarshal(msg.Data, &req); err != nil {
+			s.sendError(msg.ID, ErrorCodeInvalidMessage, err)
+			return false
+		}
+
+		var err error
+		if msg.Type == MessageTypeSubscribe {
+			err = s.client.SubscribeTracks(req.Tracks)
+		} else {
+			err = s.client.UnsubscribeTracks(req.Tracks)
+		}
+
+		if err != nil {
+			s.sendError(msg.ID, ErrorCodeSubscriptionFailed, err)
+		}
+	case MessageTypeGetMetadata:
+		req := MetadataRequest{}
+		if err := json.Unmarshal(msg.Data, &req); err != nil {
+			s.sendError(msg.ID, ErrorCodeInvalidMessage, err)
+			return false
+		}
+
+		s.getMetadata(msg.ID, req)
+	case MessageTypeSetMetadata:
+		req := SetMetadataRequest{}
+		if err := json.Unmarshal(msg.Data, &req); err != nil || req.Key == "" {
+			s.sendError(msg.ID, ErrorCodeInvalidMessage, errors.New("key is required"))
+			return false
+		}
+
+		s.setMetadata(msg.ID, req)
+	case MessageTypeLeave:
+		s.reply(msg.ID, MessageTypeLeft, Left{ClientID: s.client.ID()})
+		return true
+	default:
+		s.sendError(msg.ID, ErrorCodeUnknownMessageType, errors.New("unknown message type "+msg.Type))
+	}
+
+	return false
+}
+
+func (s *session) join(requestID string, req JoinRequest) {
+	if s.getClient() != nil {
+		s.sendError(requestID, ErrorCodeAlreadyJoined, errors.New("already joined a room"))
+		return
+	}
+
+	room, err := s.server.getRoom(req)
+	if err != nil {
+		s.sendError(requestID, errorCode(err), err)
+		return
+	}
+
+	opts := s.server.options.ClientOptions
+	opts.Token = req.Token
+
+	if req.AutoSubscribe != nil {
+		opts.AutoSubscribe = *req.AutoSubscribe
+	}
+
+	client, err := room.AddClient(req.ClientID, req.Name, opts)
+	if err != nil {
+		s.sendError(requestID, errorCode(err), err)
+		return
+	}
+
+	s.mu.Lock()
+	s.room = room
+	s.client = client
+	s.mu.Unlock()
+
+	s.server.addSession(s)
+
+	client.OnIceCandidate(func(_ context.Context, candidate *webrtc.ICECandidate) {
+		if err := s.send(MessageTypeCandidate, "", Candidate{Candidate: candidate.ToJSON()}); err != nil {
+			s.server.log.Debugf("signaling: failed to send candidate to %s: %s", client.ID(), err.Error())
+		}
+	})
+
+	client.OnRenegotiation(s.renegotiate)
+
+	client.OnTracksAvailable(func(tracks []meetup.ITrack) {
+		infos := make([]meetup.TrackInfo, 0, len(tracks))
+		for _, track := range tracks {
+			infos = append(infos, meetup.NewTrackInfo(track))
+		}
+
+		if err := s.send(MessageTypeTracksAvailable, "", TracksAvailable{Tracks: infos}); err != nil {
+			s.server.log.Debugf("signaling: failed to send tracks to %s: %s", client.ID(), err.Error())
+		}
+	})
+
+	metadataCallbackID := client.Metadata().OnChange(func(change meetup.MetadataChange) {
+		s.server.broadcast(room.ID(), MessageTypeMetadataChanged, MetadataChanged{
+			Scope:          meetup.MetadataScopeClient,
+			ClientID:       client.ID(),
+			MetadataChange: change,
+		})
+	})
+
+	client.OnLeft(func() {
+		client.Metadata().RemoveOnChanged(metadataCallbackID)
+
+		_ = s.send(MessageTypeLeft, "", Left{ClientID: client.ID(), Reason: client.StopReason()})
+		s.cancel()
+		_ = s.conn.Close()
+	})
+
+	s.reply(requestID, MessageTypeJoined, JoinedResponse{
+		RoomID:   room.ID(),
+		ClientID: client.ID(),
+		Waiting:  room.IsWaiting(client.ID()),
+	})
+}
+
+// getMetadata replies with a snapshot, or with the changes after req.Since when
+// they are still kept so a client that lost a few changes doesn't refetch all.
+func (s *session) getMetadata(requestID string, req MetadataRequest) {
+	meta, err := s.metadata(req.Scope, req.ClientID)
+	if err != nil {
+		s.sendError(requestID, errorCode(err), err)
+		return
+	}
+
+	if req.Since != nil {
+		changes, err := meta.ChangesSince(*req.Since)
+		if err == nil {
+			s.reply(requestID, MessageTypeMetadata, Metadata{
+				Scope:    req.Scope,
+				ClientID: req.ClientID,
+				Revision: *req.Since + uint64(len(changes)),
+				Changes:  changes,
+			})
+
+			return
+		} else if !errors.Is(err, meetup.ErrRevisionTooOld) {
+			s.sendError(requestID, ErrorCodeInvalidMessage, err)
+			return
+		}
+	}
+
+	snapshot := meta.Snapshot()
+
+	s.reply(requestID, MessageTypeMetadata, Metadata{
+		Scope:    req.Scope,
+		ClientID: req.ClientID,
+		Revision: snapshot.Revision,
+		Entries:  snapshot.Entries,
+	})
+}
+
+func (s *session) setMetadata(requestID string, req SetMetadataRequest) {
+	meta, err := s.client.MetadataFor(req.Scope)
+	if err != nil {
+		s.sendError(requestID, errorCode(err), err)
+		return
+	}
+
+	var value any
+	if len(req.Value) > 0 {
+		if err := json.Unmarshal(req.Value, &value); err != nil {
+			s.sendError(requestID, ErrorCodeInvalidMessage, err)
+			return
+		}
+	}
+
+	var version uint64
+	if req.ExpectedVersion != nil {
+		version, err = meta.CompareAndSet(req.Key, *req.ExpectedVersion, value)
+		if err != nil {
+			s.sendError(requestID, errorCode(err), err)
+			return
+		}
+	} else {
+		meta.Set(req.Key, value)
+		_, version, _ = meta.GetVersioned(req.Key)
+	}
+
+	s.reply(requestID, MessageTypeMetadataSet, MetadataSet{
+		Scope:   req.Scope,
+		Key:     req.Key,
+		Version: version,
+	})
+}
+
+// metadata returns the room metadata or the metadata of a client of the room,
+// any client may read them.
+func (s *session) metadata(scope, clientID string) (*meetup.Metadata, error) {
+	switch scope {
+	case meetup.MetadataScopeRoom:
+		return s.room.Metadata(), nil
+	case meetup.MetadataScopeClient, "":
+		if clientID == "" || clientID == s.client.ID() {
+			return s.client.Metadata(), nil
+		}
+
+		client, err := s.room.SFU().GetClient(clientID)
+		if err != nil {
+			return nil, err
+		}
+
+		return client.Metadata(), nil
+	default:
+		return nil, meetup.ErrNotFound
+	}
+}
+
+// renegotiate sends the server offer and waits for the client to answer it, a
+// new offer replaces the one still waiting for an answer.
+func (s *session) renegotiate(ctx context.Context, offer webrtc.SessionDescription) (webrtc.SessionDescription, error) {
+	s.mu.Lock()
+	s.offers++
+	pending := &pendingAnswer{
+		id:     "renegotiate-" + strconv.FormatUint(s.offers, 10),
+		answer: make(chan webrtc.SessionDescription, 1),
+	}
+	s.pendingAnswer = pending
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		if s.pendingAnswer == pending {
+			s.pendingAnswer = nil
+		}
+		s.mu.Unlock()
+	}()
+
+	if err := s.send(MessageTypeRenegotiate, pending.id, SessionDescription{SDP: offer.SDP}); err != nil {
+		return webrtc.SessionDescription{}, err
+	}
+
+	timer := time.NewTimer(s.server.options.RenegotiationTimeout)
+	defer timer.Stop()
+
+	select {
+	case answer := <-pending.answer:
+		return answer, nil
+	case <-timer.C:
+		return webrtc.SessionDescription{}, ErrRenegotiationTimeout
+	case <-ctx.Done():
+		return webrtc.SessionDescription{}, ctx.Err()
+	case <-s.context.Done():
+		return webrtc.SessionDescription{}, ErrSessionClosed
+	}
+}
+
+func (s *session) reply(requestID, messageType string, data any) {
+	if err := s.send(messageType, requestID, data); err != nil {
+		s.server.log.Debugf("signaling: failed to send %s: %s", messageType, err.Error())
+	}
+}
+
+func (s *session) sendError(requestID string, code ErrorCode, err error) {
+	s.reply(requestID, MessageTypeError, Error{Code: code, Message: err.Error()})
+}
+
+func (s *session) send(messageType, requestID string, data any) error {
+	if s.context.Err() != nil {
+		return ErrSessionClosed
+	}
+
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	msg, err := json.Marshal(Message{Type: messageType, ID: requestID, Data: payload})
+	if err != nil {
+		return err
+	}
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	return s.conn.WriteMessage(websocket.TextMessage, msg)
+}
+
+func errorCode(err error) ErrorCode {
+	switch {
+	case errors.Is(err, meetup.ErrRoomNotFound):
+		return ErrorCodeRoomNotFound
+	case errors.Is(err, meetup.ErrClientExists):
+		return ErrorCodeClientExists
+	case errors.Is(err, meetup.ErrRoomIsClosed):
+		return ErrorCodeRoomClosed
+	case errors.Is(err, meetup.ErrRoomIsFull):
+		return ErrorCodeRoomFull
+	case errors.Is(err, meetup.ErrClientBanned):
+		return ErrorCodeBanned
+	case errors.Is(err, meetup.ErrInvalidToken), errors.Is(err, meetup.ErrTokenExpired), errors.Is(err, meetup.ErrTokenMismatch):
+		return ErrorCodeUnauthorized
+	case errors.Is(err, meetup.ErrPermissionDenied):
+		return ErrorCodePermissionDenied
+	case errors.Is(err, meetup.ErrVersionConflict):
+		return ErrorCodeMetadataConflict
+	case errors.Is(err, meetup.ErrNotFound), errors.Is(err, meetup.ErrClientNotFound):
+		return ErrorCodeInvalidMessage
+	default:
+		return ErrorCodeInternalServerError
+	}
+}
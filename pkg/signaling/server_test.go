@@ -0,0 +1,341 @@
+package signaling
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gautam24s/meetup"
+	"github.com/gorilla/websocket"
+	"github.com/pion/webrtc/v4"
+)
+
+func newTestManager(t *testing.T) *meetup.Manager {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	return meetup.NewManager(ctx, "test", meetup.DefaultOptions())
+}
+
+func newTestRoom(t *testing.T, manager *meetup.Manager, id string, opts meetup.RoomOptions) *meetup.Room {
+	t.Helper()
+
+	room, err := manager.NewRoom(id, id, meetup.RoomKindMeeting, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return room
+}
+
+type testConn struct {
+	t    *testing.T
+	conn *websocket.Conn
+}
+
+func newTestServer(t *testing.T, manager *meetup.Manager, opts Options) (*Server, func() *testConn) {
+	t.Helper()
+
+	server := NewServer(manager, opts)
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+
+	dial := func() *testConn {
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(httpServer.URL, "http"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		t.Cleanup(func() { _ = conn.Close() })
+
+		return &testConn{t: t, conn: conn}
+	}
+
+	return server, dial
+}
+
+func (c *testConn) send(messageType, id string, data any) {
+	c.t.Helper()
+
+	payload, err := json.Marshal(data)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+
+	if err := c.conn.WriteJSON(Message{Type: messageType, ID: id, Data: payload}); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// expect reads messages until one of the type, the server sends candidates and
+// track updates between the replies.
+func (c *testConn) expect(messageType string, data any) Message {
+	c.t.Helper()
+
+	_ = c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	for {
+		msg := Message{}
+		if err := c.conn.ReadJSON(&msg); err != nil {
+			c.t.Fatalf("waiting for %s: %s", messageType, err)
+		}
+
+		if msg.Type != messageType {
+			if msg.Type == MessageTypeError {
+				c.t.Fatalf("waiting for %s, got error %s", messageType, msg.Data)
+			}
+
+			continue
+		}
+
+		if data != nil {
+			if err := json.Unmarshal(msg.Data, data); err != nil {
+				c.t.Fatal(err)
+			}
+		}
+
+		return msg
+	}
+}
+
+func (c *testConn) expectError(id string, code ErrorCode) {
+	c.t.Helper()
+
+	_ = c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	for {
+		msg := Message{}
+		if err := c.conn.ReadJSON(&msg); err != nil {
+			c.t.Fatalf("waiting for error %d: %s", code, err)
+		}
+
+		if msg.Type != MessageTypeError {
+			continue
+		}
+
+		data := Error{}
+		if err := json.Unmarshal(msg.Data, &data); err != nil {
+			c.t.Fatal(err)
+		}
+
+		if msg.ID != id || data.Code != code {
+			c.t.Fatalf("error %q %d %s, want %q %d", msg.ID, data.Code, data.Message, id, code)
+		}
+
+		return
+	}
+}
+
+func (c *testConn) join(roomID, clientID string) JoinedResponse {
+	c.t.Helper()
+
+	c.send(MessageTypeJoin, "join", JoinRequest{RoomID: roomID, ClientID: clientID})
+
+	joined := JoinedResponse{}
+	if msg := c.expect(MessageTypeJoined, &joined); msg.ID != "join" {
+		c.t.Errorf("joined id = %q, want join", msg.ID)
+	}
+
+	return joined
+}
+
+func TestErrorCode(t *testing.T) {
+	testCases := []struct {
+		err  error
+		want ErrorCode
+	}{
+		{meetup.ErrRoomNotFound, ErrorCodeRoomNotFound},
+		{meetup.ErrClientExists, ErrorCodeClientExists},
+		{meetup.ErrRoomIsClosed, ErrorCodeRoomClosed},
+		{meetup.ErrRoomIsFull, ErrorCodeRoomFull},
+		{meetup.ErrClientBanned, ErrorCodeBanned},
+		{meetup.ErrInvalidToken, ErrorCodeUnauthorized},
+		{meetup.ErrTokenExpired, ErrorCodeUnauthorized},
+		{meetup.ErrTokenMismatch, ErrorCodeUnauthorized},
+		{meetup.ErrPermissionDenied, ErrorCodePermissionDenied},
+		{meetup.ErrVersionConflict, ErrorCodeMetadataConflict},
+		{meetup.ErrNotFound, ErrorCodeInvalidMessage},
+		{meetup.ErrClientNotFound, ErrorCodeInvalidMessage},
+		{fmt.Errorf("join: %w", meetup.ErrRoomIsFull), ErrorCodeRoomFull},
+		{errors.New("unknown"), ErrorCodeInternalServerError},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.err.Error(), func(t *testing.T) {
+			if got := errorCode(tc.err); got != tc.want {
+				t.Errorf("errorCode(%v) = %d, want %d", tc.err, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestServerJoin(t *testing.T) {
+	manager := newTestManager(t)
+
+	opts := meetup.DefaultRoomOptions()
+	opts.MaxClients = 2
+	room := newTestRoom(t, manager, "room", opts)
+
+	_, dial := newTestServer(t, manager, DefaultOptions())
+
+	alice := dial()
+
+	alice.send(MessageTypeOffer, "offer", SessionDescription{})
+	alice.expectError("offer", ErrorCodeNotJoined)
+
+	alice.send(MessageTypeJoin, "missing", JoinRequest{})
+	alice.expectError("missing", ErrorCodeInvalidMessage)
+
+	alice.send(MessageTypeJoin, "unknown", JoinRequest{RoomID: "unknown"})
+	alice.expectError("unknown", ErrorCodeRoomNotFound)
+
+	if joined := alice.join("room", "alice"); joined.ClientID != "alice" || joined.RoomID != "room" || joined.Waiting {
+		t.Errorf("joined = %+v, want alice in room", joined)
+	}
+
+	alice.send(MessageTypeJoin, "again", JoinRequest{RoomID: "room"})
+	alice.expectError("again", ErrorCodeAlreadyJoined)
+
+	alice.send("dance", "dance", nil)
+	alice.expectError("dance", ErrorCodeUnknownMessageType)
+
+	if err := alice.conn.WriteMessage(websocket.TextMessage, []byte("{")); err != nil {
+		t.Fatal(err)
+	}
+
+	alice.expectError("", ErrorCodeInvalidMessage)
+
+	duplicate := dial()
+	duplicate.send(MessageTypeJoin, "duplicate", JoinRequest{RoomID: "room", ClientID: "alice"})
+	duplicate.expectError("duplicate", ErrorCodeClientExists)
+
+	duplicate.join("room", "bob")
+
+	carol := dial()
+	carol.send(MessageTypeJoin, "full", JoinRequest{RoomID: "room", ClientID: "carol"})
+	carol.expectError("full", ErrorCodeRoomFull)
+
+	alice.send(MessageTypeLeave, "leave", nil)
+
+	left := Left{}
+	if alice.expect(MessageTypeLeft, &left); left.ClientID != "alice" {
+		t.Errorf("left = %+v, want alice", left)
+	}
+
+	// the place of alice is free again once the server stopped the client
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+		if _, err := room.GetClient("alice"); err != nil {
+			break
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	carol.join("room", "carol")
+}
+
+func TestServerJoinAutoCreate(t *testing.T) {
+	manager := newTestManager(t)
+
+	opts := DefaultOptions()
+	opts.AutoCreateRooms = true
+	opts.RoomOptions.EnableLobby = true
+
+	_, dial := newTestServer(t, manager, opts)
+
+	alice := dial()
+	if joined := alice.join("created", "alice"); !joined.Waiting {
+		t.Errorf("joined = %+v, want waiting in the lobby", joined)
+	}
+
+	room, err := manager.GetRoom("created")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if room.Kind() != opts.RoomKind {
+		t.Errorf("room kind = %s, want %s", room.Kind(), opts.RoomKind)
+	}
+
+	if !room.IsWaiting("alice") {
+		t.Error("alice should wait in the lobby")
+	}
+}
+
+func TestServerAnswerMatching(t *testing.T) {
+	manager := newTestManager(t)
+	newTestRoom(t, manager, "room", meetup.DefaultRoomOptions())
+
+	server, dial := newTestServer(t, manager, DefaultOptions())
+
+	alice := dial()
+	alice.join("room", "alice")
+
+	alice.send(MessageTypeAnswer, "renegotiate-1", SessionDescription{SDP: "answer"})
+	alice.expectError("renegotiate-1", ErrorCodeUnexpectedAnswer)
+
+	server.mu.Lock()
+	sess := server.sessions["room"]["alice"]
+	server.mu.Unlock()
+
+	type result struct {
+		answer webrtc.SessionDescription
+		err    error
+	}
+
+	renegotiate := func() chan result {
+		results := make(chan result, 1)
+
+		go func() {
+			answer, err := sess.renegotiate(context.Background(), webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: "offer"})
+			results <- result{answer, err}
+		}()
+
+		return results
+	}
+
+	// a new offer replaces the one waiting, only its answer is accepted
+	first := renegotiate()
+	firstOffer := alice.expect(MessageTypeRenegotiate, nil)
+
+	second := renegotiate()
+	secondOffer := alice.expect(MessageTypeRenegotiate, nil)
+
+	if firstOffer.ID == secondOffer.ID {
+		t.Fatalf("offers share the id %s", firstOffer.ID)
+	}
+
+	alice.send(MessageTypeAnswer, firstOffer.ID, SessionDescription{SDP: "stale"})
+	alice.expectError(firstOffer.ID, ErrorCodeUnexpectedAnswer)
+
+	alice.send(MessageTypeAnswer, secondOffer.ID, SessionDescription{SDP: "answer"})
+
+	select {
+	case res := <-second:
+		if res.err != nil || res.answer.SDP != "answer" || res.answer.Type != webrtc.SDPTypeAnswer {
+			t.Errorf("renegotiate = %+v, %v, want the answer", res.answer, res.err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the answer didn't reach the renegotiation")
+	}
+
+	// the replaced offer waits until it times out or the session closes
+	alice.send(MessageTypeLeave, "leave", nil)
+	alice.expect(MessageTypeLeft, nil)
+
+	select {
+	case res := <-first:
+		if res.err == nil {
+			t.Errorf("replaced renegotiation = %+v, want an error", res.answer)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the replaced renegotiation didn't end with the session")
+	}
+}
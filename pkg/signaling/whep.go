@@ -0,0 +1,176 @@
+package signaling
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gautam24s/meetup"
+	"github.com/pion/logging"
+	"github.com/pion/webrtc/v4"
+)
+
+var ErrNoTracksAvailable = errors.New("signaling: error no tracks to view in the room")
+
+// WHEPHandler lets a player view a room with WHEP, it serves
+//
+//	POST   /{room}            the SDP offer, replies 201 with the answer and the
+//	                          resource URL in the Location header
+//	PATCH  /{room}/{resource} trickled ICE candidates as an SDP fragment
+//	DELETE /{room}/{resource} stops viewing
+//
+// The viewer picks the tracks with the query, track=<client_id>/<track_id> and
+// client=<client_id> can be repeated. Without them the viewer follows the active
+// speaker on a single audio and video track. The tracks are subscribed before the
+// offer is answered, the offer needs a media section for each of them.
+//
+// Mount it with http.StripPrefix, the resource URL is built from the request URI.
+type WHEPHandler struct {
+	manager   *meetup.Manager
+	options   Options
+	mux       *http.ServeMux
+	resources *resources
+}
+
+func NewWHEPHandler(manager *meetup.Manager, opts Options) *WHEPHandler {
+	if opts.Log == nil {
+		opts.Log = logging.NewDefaultLoggerFactory().NewLogger("whep")
+	}
+
+	h := &WHEPHandler{
+		manager:   manager,
+		options:   opts,
+		mux:       http.NewServeMux(),
+		resources: newResources(opts.Log),
+	}
+
+	h.mux.HandleFunc("POST /{room}", h.view)
+	h.mux.HandleFunc("PATCH /{room}/{resource}", h.resources.trickle)
+	h.mux.HandleFunc("DELETE /{room}/{resource}", h.resources.stop)
+
+	return h
+}
+
+func (h *WHEPHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *WHEPHandler) view(w http.ResponseWriter, r *http.Request) {
+	offer, ok := readSessionDescription(w, r)
+	if !ok {
+		return
+	}
+
+	// viewers never create rooms
+	room, err := h.manager.GetRoom(r.PathValue("room"))
+	if err != nil {
+		writeHTTPError(w, err)
+		return
+	}
+
+	opts := h.options.ClientOptions
+	opts.AutoSubscribe = false
+	opts.ReceiveOnly = true
+	opts.IceTrickle = false
+	opts.Token = bearerToken(r)
+	opts.EnableVoiceDetection = false
+
+	client, err := room.AddClient("", r.URL.Query().Get("name"), opts)
+	if err != nil {
+		writeHTTPError(w, err)
+		return
+	}
+
+	if !client.Permissions().CanSubscribe {
+		_ = client.Stop()
+		writeHTTPError(w, meetup.ErrPermissionDenied)
+
+		return
+	}
+
+	// the viewer picked its tracks, the room last-N doesn't apply
+	client.SetLastN(-1)
+
+	if err := h.subscribe(client, r); err != nil {
+		_ = client.Stop()
+		writeHTTPError(w, err)
+
+		return
+	}
+
+	answer, err := negotiate(client, offer)
+	if err != nil {
+		writeNegotiationError(w, client, err)
+		return
+	}
+
+	unsubscribeUnnegotiated(client)
+
+	resourceID := h.resources.add(room.ID(), client)
+	h.resources.writeAnswer(w, r, resourceID, answer)
+}
+
+func (h *WHEPHandler) subscribe(client *meetup.Client, r *http.Request) error {
+	query := r.URL.Query()
+
+	requests := make([]meetup.SubscribeRequest, 0)
+
+	for _, value := range query["track"] {
+		clientID, trackID, ok := strings.Cut(value, "/")
+		if !ok {
+			continue
+		}
+
+		requests = append(requests, meetup.SubscribeRequest{ClientID: clientID, TrackID: trackID})
+	}
+
+	for _, available := range client.AvailableTracks() {
+		for _, clientID := range query["client"] {
+			if available.ClientID() == clientID {
+				requests = append(requests, meetup.SubscribeRequest{ClientID: clientID, TrackID: available.ID()})
+			}
+		}
+	}
+
+	var err error
+	if len(query["track"]) == 0 && len(query["client"]) == 0 {
+		err = client.FollowActiveSpeaker()
+	} else {
+		err = client.SubscribeTracks(requests)
+	}
+
+	if len(client.ClientTracks()) == 0 {
+		return ErrNoTracksAvailable
+	}
+
+	// a missing track is reported only when nothing could be subscribed
+	if err != nil {
+		h.options.Log.Debugf("whep: viewer %s subscribed partially: %s", client.ID(), err.Error())
+	}
+
+	return nil
+}
+
+// unsubscribeUnnegotiated drops the tracks the offer had no media section for,
+// WHEP has no renegotiation to add them later.
+func unsubscribeUnnegotiated(client *meetup.Client) {
+	negotiated := make(map[*webrtc.RTPSender]bool)
+
+	for _, transceiver := range client.PeerConnection().PC().GetTransceivers() {
+		if transceiver.Mid() != "" && transceiver.Sender() != nil {
+			negotiated[transceiver.Sender()] = true
+		}
+	}
+
+	requests := make([]meetup.SubscribeRequest, 0)
+
+	for _, ct := range client.ClientTracks() {
+		if !negotiated[ct.Sender()] {
+			requests = append(requests, meetup.SubscribeRequest{ClientID: ct.Track().ClientID(), TrackID: ct.ID()})
+		}
+	}
+
+	if len(requests) > 0 {
+		_ = client.UnsubscribeTracks(requests)
+	}
+}
@@ -0,0 +1,87 @@
+package signaling
+
+import (
+	"net/http"
+
+	"github.com/gautam24s/meetup"
+	"github.com/pion/logging"
+)
+
+// WHIPHandler lets an encoder publish into a room with WHIP, it serves
+//
+//	POST   /{room}            the SDP offer, replies 201 with the answer and the
+//	                          resource URL in the Location header
+//	PATCH  /{room}/{resource} trickled ICE candidates as an SDP fragment
+//	DELETE /{room}/{resource} stops publishing
+//
+// Mount it with http.StripPrefix, the resource URL is built from the request URI.
+type WHIPHandler struct {
+	manager   *meetup.Manager
+	options   Options
+	mux       *http.ServeMux
+	resources *resources
+}
+
+func NewWHIPHandler(manager *meetup.Manager, opts Options) *WHIPHandler {
+	if opts.Log == nil {
+		opts.Log = logging.NewDefaultLoggerFactory().NewLogger("whip")
+	}
+
+	h := &WHIPHandler{
+		manager:   manager,
+		options:   opts,
+		mux:       http.NewServeMux(),
+		resources: newResources(opts.Log),
+	}
+
+	h.mux.HandleFunc("POST /{room}", h.publish)
+	h.mux.HandleFunc("PATCH /{room}/{resource}", h.resources.trickle)
+	h.mux.HandleFunc("DELETE /{room}/{resource}", h.resources.stop)
+
+	return h
+}
+
+func (h *WHIPHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *WHIPHandler) publish(w http.ResponseWriter, r *http.Request) {
+	offer, ok := readSessionDescription(w, r)
+	if !ok {
+		return
+	}
+
+	room, err := getRoom(h.manager, h.options, r.PathValue("room"))
+	if err != nil {
+		writeHTTPError(w, err)
+		return
+	}
+
+	opts := h.options.ClientOptions
+	opts.AutoSubscribe = false
+	// the answer carries every candidate, encoders don't all trickle
+	opts.IceTrickle = false
+	opts.Token = bearerToken(r)
+
+	client, err := room.AddClient("", r.URL.Query().Get("name"), opts)
+	if err != nil {
+		writeHTTPError(w, err)
+		return
+	}
+
+	if permissions := client.Permissions(); !permissions.CanPublishAudio && !permissions.CanPublishVideo {
+		_ = client.Stop()
+		writeHTTPError(w, meetup.ErrPermissionDenied)
+
+		return
+	}
+
+	answer, err := negotiate(client, offer)
+	if err != nil {
+		writeNegotiationError(w, client, err)
+		return
+	}
+
+	resourceID := h.resources.add(room.ID(), client)
+	h.resources.writeAnswer(w, r, resourceID, answer)
+}
@@ -74,6 +74,10 @@ func newRemoteTrack(
 
 	go rt.readRTP()
 
+	if statsGetter != nil {
+		go rt.loopUpdateStats()
+	}
+
 	return rt
 }
 
@@ -200,3 +204,57 @@ func (t *remoteTrack) onEnded() {
 		callback()
 	}
 }
+
+func (t *remoteTrack) OnEnded(callback func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.onEndedCallbacks = append(t.onEndedCallbacks, callback)
+}
+
+func (t *remoteTrack) Track() IRemoteTrack {
+	return t.track
+}
+
+func (t *remoteTrack) ReceiveBitrate() uint32 {
+	return t.bitrate.Load()
+}
+
+func (t *remoteTrack) loopUpdateStats() {
+	ctx, cancel := context.WithCancel(t.context)
+	defer cancel()
+
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			t.updateStats()
+		}
+	}
+}
+
+func (t *remoteTrack) updateStats() {
+	s := t.statsGetter.Get(uint32(t.track.SSRC()))
+	if s == nil {
+		return
+	}
+
+	now := uint64(time.Now().UnixNano())
+	current := s.InboundRTPStreamStats.BytesReceived
+	previous := t.currentBytesReceived.Swap(current)
+	t.previousBytesReceived.Store(previous)
+	lastUpdate := t.latestUpdatesTS.Swap(now)
+
+	if lastUpdate > 0 && now > lastUpdate && current >= previous {
+		elapsed := time.Duration(now - lastUpdate).Seconds()
+		t.bitrate.Store(uint32(float64(current-previous) * 8 / elapsed))
+	}
+
+	if t.onStatsUpdated != nil {
+		t.onStatsUpdated(s)
+	}
+}
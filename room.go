@@ -35,17 +35,46 @@ func DefaultOptions() Options {
 	}
 }
 
+const (
+	StateRoomOpen   = "open"
+	StateRoomClosed = "closed"
+
+	EventTypeDominantSpeakerChanged = "dominant_speaker_changed"
+	EventTypeTrackMuted             = "track_muted"
+	EventTypeTrackUnmuted           = "track_unmuted"
+	EventTypeTrackUnpublished       = "track_unpublished"
+	EventTypePermissionsChanged     = "permissions_changed"
+	EventTypeClientWaiting          = "client_waiting"
+	EventTypeClientAdmitted         = "client_admitted"
+	EventTypeClientRejected         = "client_rejected"
+	EventTypeClientKicked           = "client_kicked"
+	EventTypeClientBanned           = "client_banned"
+	EventTypeMetadataChanged        = "metadata_changed"
+)
+
 type RoomOptions struct {
-	Bitrates         BitrateConfigs `json:"bitrates,omitempty"`
-	Codecs           *[]string      `json:"codecs,omitempty"`
-	PLIInterval      *time.Duration `json:"pli_interval_ns,omitempty"`
-	QualityLevels    []QualityLevel `json:"quality_levels,omitempty"`
-	EmptyRoomTimeout *time.Duration `json:"empty_room_timeout_ns,omitempty"`
+	Bitrates            BitrateConfigs `json:"bitrates,omitempty"`
+	Codecs              *[]string      `json:"codecs,omitempty"`
+	PLIInterval         *time.Duration `json:"pli_interval_ns,omitempty"`
+	QualityLevels       []QualityLevel `json:"quality_levels,omitempty"`
+	EmptyRoomTimeout    *time.Duration `json:"empty_room_timeout_ns,omitempty"`
+	LastN               int            `json:"last_n,omitempty"`
+	AudioTopN           int            `json:"audio_top_n,omitempty"`
+	AudioTopNHold       *time.Duration `json:"audio_top_n_hold_ns,omitempty"`
+	AudioTopNMinClients *int           `json:"audio_top_n_min_clients,omitempty"`
+	MaxClients          int            `json:"max_clients,omitempty"`
+	TokenKey            *TokenKey      `json:"-"`
+	EnableLobby         bool           `json:"enable_lobby,omitempty"`
+	BanStore            BanStore       `json:"-"`
+	DataChannelHistory  int            `json:"data_channel_history,omitempty"`
+	MaxDataChannels     int            `json:"max_data_channels,omitempty"`
 }
 
 func DefaultRoomOptions() RoomOptions {
 	pli := time.Duration(0)
 	emptyDuration := time.Duration(3) * time.Minute
+	audioTopNHold := time.Second
+	audioTopNMinClients := 6
 	return RoomOptions{
 		Bitrates:      DefaultBitrates(),
 		QualityLevels: DefaultQualityLevels(),
@@ -56,8 +85,11 @@ func DefaultRoomOptions() RoomOptions {
 			"audio/red",
 			webrtc.MimeTypeOpus,
 		},
-		PLIInterval:      &pli,
-		EmptyRoomTimeout: &emptyDuration,
+		PLIInterval:         &pli,
+		EmptyRoomTimeout:    &emptyDuration,
+		AudioTopNHold:       &audioTopNHold,
+		AudioTopNMinClients: &audioTopNMinClients,
+		MaxDataChannels:     16,
 	}
 }
 
@@ -71,16 +103,271 @@ type Room struct {
 	onRoomClosedCallbacks   []func(id string)
 	onClientJoinedCallbacks []func(*Client)
 	onClientLeftCallbacks   []func(*Client)
+	onWaitingCallbacks      []func(*Client)
 	context                 context.Context
 	cancel                  context.CancelFunc
 	id                      string
-	token                   string
 	RenegotiationChan       map[string]chan bool
 	name                    string
 	mu                      *sync.RWMutex
 	meta                    *Metadata
+	lobby                   *lobby
+	bans                    map[string]time.Time
 	state                   string
 	kind                    string
 	OnEvent                 func(event Event)
 	options                 RoomOptions
+	sfu                     *SFU
+}
+
+func newRoom(ctx context.Context, id, name string, sfu *SFU, kind string, opts RoomOptions) *Room {
+	localCtx, cancel := context.WithCancel(ctx)
+
+	room := &Room{
+		onRoomClosedCallbacks:   make([]func(id string), 0),
+		onClientJoinedCallbacks: make([]func(*Client), 0),
+		onClientLeftCallbacks:   make([]func(*Client), 0),
+		onWaitingCallbacks:      make([]func(*Client), 0),
+		lobby:                   newLobby(),
+		bans:                    make(map[string]time.Time),
+		meta:                    sfu.meta,
+		context:                 localCtx,
+		cancel:                  cancel,
+		id:                      id,
+		RenegotiationChan:       make(map[string]chan bool),
+		name:                    name,
+		mu:                      &sync.RWMutex{},
+		state:                   StateRoomOpen,
+		kind:                    kind,
+		options:                 opts,
+		sfu:                     sfu,
+	}
+
+	room.loadBans()
+
+	room.meta.OnChange(room.broadcastMetadata)
+
+	sfu.OnDominantSpeakerChanged(func(previousID, currentID string) {
+		room.onEvent(EventTypeDominantSpeakerChanged, map[string]any{
+			"previous_client_id": previousID,
+			"client_id":          currentID,
+		})
+	})
+
+	sfu.OnTrackMuteChanged(func(track ITrack) {
+		eventType := EventTypeTrackUnmuted
+		if track.IsMuted() {
+			eventType = EventTypeTrackMuted
+		}
+
+		room.onEvent(eventType, map[string]any{
+			"client_id": track.ClientID(),
+			"track_id":  track.ID(),
+			"hard":      track.IsHardMuted(),
+		})
+	})
+
+	return room
+}
+
+func (r *Room) ID() string {
+	return r.id
+}
+
+func (r *Room) Name() string {
+	return r.name
+}
+
+func (r *Room) Kind() string {
+	return r.kind
+}
+
+func (r *Room) SFU() *SFU {
+	return r.sfu
+}
+
+func (r *Room) Context() context.Context {
+	return r.context
+}
+
+// AddClient adds a client to the room. When the room requires tokens the client
+// joins with the token in opts, an empty id or name is taken from the token. An
+// empty id is generated otherwise. With the lobby enabled the client waits
+// without media until a moderator admits it.
+func (r *Room) AddClient(id, name string, opts ClientOptions) (*Client, error) {
+	r.mu.RLock()
+	state := r.state
+	r.mu.RUnlock()
+
+	if state == StateRoomClosed {
+		return nil, ErrRoomIsClosed
+	}
+
+	role := DefaultRole(r.kind)
+
+	if r.options.TokenKey != nil {
+		claims, err := r.verifyToken(id, opts.Token)
+		if err != nil {
+			return nil, err
+		}
+
+		id = claims.Identity
+		if name == "" {
+			name = claims.Name
+		}
+
+		if claims.Role != "" {
+			role = claims.Role
+		}
+
+		if claims.Permissions != nil {
+			role = claims.Role
+			opts.permissions = claims.Permissions
+		}
+	}
+
+	if opts.permissions == nil {
+		permissions, err := PermissionsPreset(r.kind, role)
+		if err != nil {
+			return nil, err
+		}
+
+		opts.permissions = &permissions
+	}
+
+	opts.role = role
+
+	// moderators skip the lobby so there is someone to admit the others
+	admittedPermissions := *opts.permissions
+	waiting := r.options.EnableLobby && !admittedPermissions.IsModerator
+
+	if waiting {
+		opts.permissions = &Permissions{}
+	}
+
+	if id == "" {
+		id = GenerateID(16)
+	}
+
+	if r.IsBanned(id) {
+		return nil, ErrClientBanned
+	}
+
+	client, err := r.sfu.NewClient(id, name, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	client.OnJoined(func() {
+		r.onClientJoined(client)
+	})
+
+	client.OnLeft(func() {
+		r.lobby.remove(client.ID())
+		r.onClientLeft(client)
+	})
+
+	if waiting {
+		r.lobby.add(client, role, admittedPermissions)
+		r.onClientWaiting(client)
+	}
+
+	return client, nil
+}
+
+func (r *Room) verifyToken(id, token string) (*TokenClaims, error) {
+	claims, err := r.options.TokenKey.Verify(token)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.RoomID != r.id || claims.Identity == "" || (id != "" && id != claims.Identity) {
+		return nil, ErrTokenMismatch
+	}
+
+	return claims, nil
+}
+
+func (r *Room) onEvent(eventType string, data map[string]any) {
+	if r.OnEvent == nil {
+		return
+	}
+
+	r.OnEvent(Event{
+		Type: eventType,
+		Time: time.Now(),
+		Data: data,
+	})
+}
+
+func (r *Room) GetClient(id string) (*Client, error) {
+	return r.sfu.GetClient(id)
+}
+
+func (r *Room) OnClientJoined(callback func(*Client)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.onClientJoinedCallbacks = append(r.onClientJoinedCallbacks, callback)
+}
+
+func (r *Room) onClientJoined(client *Client) {
+	r.mu.RLock()
+	callbacks := r.onClientJoinedCallbacks
+	r.mu.RUnlock()
+
+	for _, callback := range callbacks {
+		callback(client)
+	}
+}
+
+func (r *Room) OnClientLeft(callback func(*Client)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.onClientLeftCallbacks = append(r.onClientLeftCallbacks, callback)
+}
+
+func (r *Room) onClientLeft(client *Client) {
+	r.mu.RLock()
+	callbacks := r.onClientLeftCallbacks
+	r.mu.RUnlock()
+
+	for _, callback := range callbacks {
+		callback(client)
+	}
+}
+
+func (r *Room) Close() error {
+	r.mu.Lock()
+
+	if r.state == StateRoomClosed {
+		r.mu.Unlock()
+		return ErrRoomIsClosed
+	}
+
+	if r.sfu.clients.Length() > 0 {
+		r.mu.Unlock()
+		return ErrRoomIsNotEmpty
+	}
+
+	r.state = StateRoomClosed
+	callbacks := r.onRoomClosedCallbacks
+	r.mu.Unlock()
+
+	r.sfu.cancel()
+	r.cancel()
+
+	for _, callback := range callbacks {
+		callback(r.id)
+	}
+
+	return nil
+}
+
+func (r *Room) OnRoomClosed(callback func(id string)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.onRoomClosedCallbacks = append(r.onRoomClosedCallbacks, callback)
 }
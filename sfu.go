@@ -5,6 +5,8 @@ import (
 	"sync"
 	"time"
 
+	"github.com/gautam24s/meetup/pkg/interceptors/voiceactivedetector"
+	"github.com/gautam24s/meetup/pkg/rtppool"
 	"github.com/pion/logging"
 	"github.com/pion/webrtc/v4"
 )
@@ -38,8 +40,9 @@ func DefaultBitrates() BitrateConfigs {
 }
 
 type SFUClients struct {
-	clients map[string]*Client
-	mu      sync.Mutex
+	clients    map[string]*Client
+	maxClients int
+	mu         sync.Mutex
 }
 
 func (s *SFUClients) GetClients() map[string]*Client {
@@ -80,6 +83,10 @@ func (s *SFUClients) Add(client *Client) error {
 		return ErrClientExists
 	}
 
+	if s.maxClients > 0 && len(s.clients) >= s.maxClients {
+		return ErrRoomIsFull
+	}
+
 	s.clients[client.ID()] = client
 
 	return nil
@@ -89,7 +96,8 @@ func (s *SFUClients) Remove(client *Client) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if _, ok := s.clients[client.ID()]; !ok {
+	// a client that failed to join must not remove the one holding its ID
+	if existing, ok := s.clients[client.ID()]; !ok || existing != client {
 		return ErrClientNotFound
 	}
 
@@ -99,23 +107,35 @@ func (s *SFUClients) Remove(client *Client) error {
 }
 
 type SFU struct {
-	bitrateConfigs BitrateConfigs
-	clients        *SFUClients
-	context        context.Context
-	cancel         context.CancelFunc
-	codecs         []string
-	// dataChannels   *SFUDataChannelList
-	iceServers                 []webrtc.ICEServer
-	mu                         sync.Mutex
-	onStop                     func()
-	pliInterval                time.Duration
-	onTracksAvailableCallbacks []func(tracks ITrack)
-	onClientRemovedCallbacks   []func(*Client)
-	onClientAddedCallbacks     []func(*Client)
-	relayTracks                map[string]ITrack
+	bitrateConfigs              BitrateConfigs
+	clients                     *SFUClients
+	context                     context.Context
+	cancel                      context.CancelFunc
+	codecs                      []string
+	dataChannels                *SFUDataChannelList
+	iceServers                  []webrtc.ICEServer
+	mu                          sync.Mutex
+	onStop                      func()
+	pliInterval                 time.Duration
+	onTracksAvailableCallbacks  []func(tracks ITrack)
+	onClientRemovedCallbacks    []func(*Client)
+	onClientAddedCallbacks      []func(*Client)
+	onDominantSpeakerCallbacks  []func(previousID, currentID string)
+	onTrackMuteChangedCallbacks []func(track ITrack)
+	onDataMessageCallbacks      []func(DataMessage)
+	relayTracks                 map[string]ITrack
 	// clientStats                map[string]*ClientStats
-	log                  logging.LeveledLogger
-	defaultSettingEngine *webrtc.SettingEngine
+	log                     logging.LeveledLogger
+	defaultSettingEngine    *webrtc.SettingEngine
+	enableBandwithEstimator bool
+	qualityLevels           []QualityLevel
+	rtppool                 *rtppool.RTPPool
+	lastN                   *lastN
+	audioTopN               *audioTopN
+	dominantSpeaker         *dominantSpeaker
+	meta                    *Metadata
+	dataChannelHistory      int
+	maxDataChannels         int
 }
 
 type PublishedTrack struct {
@@ -124,20 +144,28 @@ type PublishedTrack struct {
 }
 
 type sfuOptions struct {
-	IceServers    []webrtc.ICEServer
-	Bitrates      BitrateConfigs
-	QualityLevel  []QualityLevel
-	Codecs        []string
-	PLIInterval   time.Duration
-	Log           logging.LeveledLogger
-	SettingEngine *webrtc.SettingEngine
+	IceServers              []webrtc.ICEServer
+	Bitrates                BitrateConfigs
+	QualityLevel            []QualityLevel
+	Codecs                  []string
+	PLIInterval             time.Duration
+	Log                     logging.LeveledLogger
+	SettingEngine           *webrtc.SettingEngine
+	EnableBandwithEstimator bool
+	LastN                   int
+	AudioTopN               int
+	AudioTopNHold           time.Duration
+	AudioTopNMinClients     int
+	DataChannelHistory      int
+	MaxDataChannels         int
+	MaxClients              int
 }
 
 func New(ctx context.Context, opts sfuOptions) *SFU {
 	localCtx, cancel := context.WithCancel(ctx)
 
 	sfu := &SFU{
-		clients:                    &SFUClients{clients: make(map[string]*Client), mu: sync.Mutex{}},
+		clients:                    &SFUClients{clients: make(map[string]*Client), maxClients: opts.MaxClients, mu: sync.Mutex{}},
 		context:                    localCtx,
 		cancel:                     cancel,
 		codecs:                     opts.Codecs,
@@ -151,28 +179,264 @@ func New(ctx context.Context, opts sfuOptions) *SFU {
 		onClientAddedCallbacks:     make([]func(*Client), 0),
 		log:                        opts.Log,
 		defaultSettingEngine:       opts.SettingEngine,
+		enableBandwithEstimator:    opts.EnableBandwithEstimator,
+		qualityLevels:              opts.QualityLevel,
+		rtppool:                    rtppool.New(),
+		meta:                       NewMetadata(),
+		dataChannels:               NewSFUDataChannelList(),
+		dataChannelHistory:         opts.DataChannelHistory,
+		maxDataChannels:            opts.MaxDataChannels,
 	}
 
+	sfu.lastN = newLastN(sfu, opts.LastN)
+	go sfu.lastN.loop()
+
+	sfu.audioTopN = newAudioTopN(sfu, opts.AudioTopN, opts.AudioTopNHold, opts.AudioTopNMinClients)
+	go sfu.audioTopN.loop()
+
+	sfu.dominantSpeaker = newDominantSpeaker(sfu, sfu.onDominantSpeakerChanged)
+	go sfu.dominantSpeaker.loop()
+
 	return sfu
 }
 
-func (s *SFU) addClient(client *Client) {
-	if err := s.clients.Add(client); err != nil {
-		s.log.Errorf("sfu: failed to add client ", err)
+func (s *SFU) NewClient(id, name string, opts ClientOptions) (*Client, error) {
+	if opts.Log == nil {
+		opts.Log = s.log
+	}
+
+	if s.defaultSettingEngine != nil {
+		opts.settingEngine = *s.defaultSettingEngine
+	}
+
+	opts.qualityLevels = s.qualityLevels
+
+	peerConnectionConfig := webrtc.Configuration{
+		ICEServers: s.iceServers,
+	}
+
+	client := NewClient(s, id, name, peerConnectionConfig, opts)
+
+	if err := s.addClient(client); err != nil {
+		_ = client.Stop()
+		return nil, err
+	}
+
+	if !opts.AutoSubscribe || !client.Permissions().CanSubscribe {
+		return client, nil
+	}
+
+	for _, existing := range s.clients.GetClients() {
+		if existing.ID() == client.ID() {
+			continue
+		}
+
+		for _, track := range existing.PublishedTracks() {
+			if _, err := client.addTrack(track); err != nil {
+				s.log.Errorf("sfu: failed to add track %s to client %s: %s", track.ID(), client.ID(), err.Error())
+			}
+		}
+	}
+
+	return client, nil
+}
+
+func (s *SFU) Context() context.Context {
+	return s.context
+}
+
+func (s *SFU) GetClient(id string) (*Client, error) {
+	return s.clients.GetClient(id)
+}
+
+func (s *SFU) GetClients() map[string]*Client {
+	return s.clients.GetClients()
+}
+
+// SetLastN changes the number of active speakers whose video is forwarded to the
+// clients that don't set their own.
+func (s *SFU) SetLastN(n int) {
+	s.lastN.setN(n)
+}
+
+func (s *SFU) OnClientAdded(callback func(*Client)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.onClientAddedCallbacks = append(s.onClientAddedCallbacks, callback)
+}
+
+func (s *SFU) OnClientRemoved(callback func(*Client)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.onClientRemovedCallbacks = append(s.onClientRemovedCallbacks, callback)
+}
+
+func (s *SFU) OnTracksAvailable(callback func(track ITrack)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.onTracksAvailableCallbacks = append(s.onTracksAvailableCallbacks, callback)
+}
+
+func (s *SFU) onTrackAvailable(track ITrack) {
+	s.mu.Lock()
+	callbacks := s.onTracksAvailableCallbacks
+	s.mu.Unlock()
+
+	for _, callback := range callbacks {
+		callback(track)
+	}
+
+	for _, client := range s.clients.GetClients() {
+		if client.ID() == track.ClientID() || !client.Permissions().CanSubscribe {
+			continue
+		}
+
+		if !client.options.AutoSubscribe {
+			client.onTracksAvailable([]ITrack{track})
+			continue
+		}
+
+		if _, err := client.addTrack(track); err != nil {
+			s.log.Errorf("sfu: failed to add track %s to client %s: %s", track.ID(), client.ID(), err.Error())
+			continue
+		}
+
+		client.renegotiate()
+	}
+}
+
+func (s *SFU) onVoiceActivity(client *Client, activity voiceactivedetector.VoiceActivity) {
+	if activity.Type == voiceactivedetector.VoiceActivityEnded {
+		return
+	}
+
+	s.lastN.onVoiceActivity(client.ID())
+	s.dominantSpeaker.onVoiceActivity(client.ID(), activity.AudioLevels)
+}
+
+// DominantSpeakerID returns the ID of the client currently dominating the
+// conversation, or an empty string if nobody spoke yet.
+func (s *SFU) DominantSpeakerID() string {
+	return s.dominantSpeaker.DominantSpeakerID()
+}
+
+func (s *SFU) OnDominantSpeakerChanged(callback func(previousID, currentID string)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.onDominantSpeakerCallbacks = append(s.onDominantSpeakerCallbacks, callback)
+}
+
+func (s *SFU) onDominantSpeakerChanged(previousID, currentID string) {
+	s.mu.Lock()
+	callbacks := s.onDominantSpeakerCallbacks
+	s.mu.Unlock()
+
+	for _, callback := range callbacks {
+		callback(previousID, currentID)
+	}
+
+	for _, client := range s.GetClients() {
+		client.onDominantSpeakerChanged(currentID)
+	}
+
+	if previousID != "" {
+		s.broadcastInternalMessage(SpeakerMessage{Type: messageTypeVADEnded, ClientID: previousID})
+	}
+
+	if currentID != "" {
+		s.broadcastInternalMessage(SpeakerMessage{Type: messageTypeVADStarted, ClientID: currentID})
+	}
+}
+
+func (s *SFU) OnTrackMuteChanged(callback func(track ITrack)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.onTrackMuteChangedCallbacks = append(s.onTrackMuteChangedCallbacks, callback)
+}
+
+type TrackMutedMessage struct {
+	ClientID string `json:"client_id"`
+	TrackID  string `json:"track_id"`
+	Muted    bool   `json:"muted"`
+	Hard     bool   `json:"hard"`
+}
+
+func (s *SFU) onTrackMuteChanged(track ITrack) {
+	s.mu.Lock()
+	callbacks := s.onTrackMuteChangedCallbacks
+	s.mu.Unlock()
+
+	for _, callback := range callbacks {
+		callback(track)
+	}
+
+	s.broadcastInternalMessage(TrackMutedMessage{
+		ClientID: track.ClientID(),
+		TrackID:  track.ID(),
+		Muted:    track.IsMuted(),
+		Hard:     track.IsHardMuted(),
+	})
+}
+
+func (s *SFU) broadcastInternalMessage(msg InternalMessage) {
+	for _, client := range s.clients.GetClients() {
+		if err := client.sendInternalMessage(msg); err != nil {
+			s.log.Debugf("sfu: failed to send %s to client %s: %s", msg.InternalMessageType(), client.ID(), err.Error())
+		}
+	}
+}
+
+func (s *SFU) getPublishedTrack(clientID, trackID string) (ITrack, error) {
+	client, err := s.clients.GetClient(clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.publishedTracks.Get(trackID)
+}
+
+func (s *SFU) removeClient(client *Client) {
+	if err := s.clients.Remove(client); err != nil {
 		return
 	}
 
+	s.lastN.removeClient(client.ID())
+	s.dominantSpeaker.removeClient(client.ID())
+
+	s.onClientRemoved(client)
+}
+
+func (s *SFU) addClient(client *Client) error {
+	if err := s.clients.Add(client); err != nil {
+		return err
+	}
+
 	s.onClientAdded(client)
+
+	return nil
 }
 
 func (s *SFU) onClientAdded(client *Client) {
-	for _, callback := range s.onClientAddedCallbacks {
+	s.mu.Lock()
+	callbacks := s.onClientAddedCallbacks
+	s.mu.Unlock()
+
+	for _, callback := range callbacks {
 		callback(client)
 	}
 }
 
 func (s *SFU) onClientRemoved(client *Client) {
-	for _, callback := range s.onClientRemovedCallbacks {
+	s.mu.Lock()
+	callbacks := s.onClientRemovedCallbacks
+	s.mu.Unlock()
+
+	for _, callback := range callbacks {
 		callback(client)
 	}
 }
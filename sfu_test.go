@@ -0,0 +1,77 @@
+package meetup
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestSFUClientsAdd(t *testing.T) {
+	clients := &SFUClients{clients: make(map[string]*Client), maxClients: 2, mu: sync.Mutex{}}
+
+	alice := &Client{id: "alice"}
+	if err := clients.Add(alice); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := clients.Add(&Client{id: "alice"}); !errors.Is(err, ErrClientExists) {
+		t.Errorf("add of a duplicate ID = %v, want %v", err, ErrClientExists)
+	}
+
+	if err := clients.Add(&Client{id: "bob"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := clients.Add(&Client{id: "carol"}); !errors.Is(err, ErrRoomIsFull) {
+		t.Errorf("add to a full room = %v, want %v", err, ErrRoomIsFull)
+	}
+
+	if clients.Length() != 2 {
+		t.Errorf("length = %d, want 2", clients.Length())
+	}
+}
+
+func TestSFUClientsAddConcurrent(t *testing.T) {
+	clients := &SFUClients{clients: make(map[string]*Client), maxClients: 3, mu: sync.Mutex{}}
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			_ = clients.Add(&Client{id: GenerateID(8)})
+			_ = clients.Add(&Client{id: "same"})
+		}()
+	}
+
+	wg.Wait()
+
+	if clients.Length() != 3 {
+		t.Errorf("length = %d, want the room capacity 3", clients.Length())
+	}
+}
+
+func TestSFUClientsRemoveStale(t *testing.T) {
+	clients := &SFUClients{clients: make(map[string]*Client), mu: sync.Mutex{}}
+
+	alice := &Client{id: "alice"}
+	if err := clients.Add(alice); err != nil {
+		t.Fatal(err)
+	}
+
+	// a second client that failed to join with the same ID
+	if err := clients.Remove(&Client{id: "alice"}); !errors.Is(err, ErrClientNotFound) {
+		t.Errorf("remove of a stale client = %v, want %v", err, ErrClientNotFound)
+	}
+
+	if client, err := clients.GetClient("alice"); err != nil || client != alice {
+		t.Errorf("client = %p, %v, want the joined client %p", client, err, alice)
+	}
+
+	if err := clients.Remove(alice); err != nil {
+		t.Errorf("remove = %v, want nil", err)
+	}
+}
@@ -0,0 +1,177 @@
+package meetup
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	tokenAlgorithmHS256 = "HS256"
+	tokenAlgorithmEdDSA = "EdDSA"
+)
+
+var (
+	ErrInvalidToken     = errors.New("token: error invalid token")
+	ErrTokenExpired     = errors.New("token: error token expired")
+	ErrTokenMismatch    = errors.New("token: error token is for another room or identity")
+	ErrTokenKeyCantSign = errors.New("token: error key has no private key to sign with")
+)
+
+// TokenClaims are the claims of a join token, the identity is the client ID. The
+// role selects the permissions preset of the room kind, permissions that are set
+// replace the preset even when they allow nothing.
+type TokenClaims struct {
+	RoomID      string       `json:"room"`
+	Identity    string       `json:"sub"`
+	Name        string       `json:"name,omitempty"`
+	IssuedAt    int64        `json:"iat"`
+	ExpiresAt   int64        `json:"exp"`
+	Role        Role         `json:"role,omitempty"`
+	Permissions *Permissions `json:"permissions,omitempty"`
+}
+
+func NewTokenClaims(roomID, identity, name string, ttl time.Duration, permissions Permissions) TokenClaims {
+	now := time.Now()
+
+	return TokenClaims{
+		RoomID:      roomID,
+		Identity:    identity,
+		Name:        name,
+		IssuedAt:    now.Unix(),
+		ExpiresAt:   now.Add(ttl).Unix(),
+		Permissions: &permissions,
+	}
+}
+
+// TokenKey signs and verifies join tokens, JWTs signed with HS256 or EdDSA.
+// A key made from an Ed25519 public key only verifies.
+type TokenKey struct {
+	algorithm  string
+	secret     []byte
+	publicKey  ed25519.PublicKey
+	privateKey ed25519.PrivateKey
+}
+
+func NewHMACTokenKey(secret []byte) *TokenKey {
+	return &TokenKey{
+		algorithm: tokenAlgorithmHS256,
+		secret:    secret,
+	}
+}
+
+// NewEd25519TokenKey returns a key that verifies with the public key, and signs
+// when the private key is not nil.
+func NewEd25519TokenKey(publicKey ed25519.PublicKey, privateKey ed25519.PrivateKey) *TokenKey {
+	return &TokenKey{
+		algorithm:  tokenAlgorithmEdDSA,
+		publicKey:  publicKey,
+		privateKey: privateKey,
+	}
+}
+
+type tokenHeader struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ"`
+}
+
+// Mint signs the claims into a token for a client to join with.
+func (k *TokenKey) Mint(claims TokenClaims) (string, error) {
+	if k.algorithm == tokenAlgorithmEdDSA && k.privateKey == nil {
+		return "", ErrTokenKeyCantSign
+	}
+
+	header, err := json.Marshal(tokenHeader{Algorithm: k.algorithm, Type: "JWT"})
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(k.sign([]byte(signingInput))), nil
+}
+
+// Verify checks the signature and the expiry of the token and returns its claims.
+func (k *TokenKey) Verify(token string) (*TokenClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	headerData, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	header := tokenHeader{}
+	if err := json.Unmarshal(headerData, &header); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	// the algorithm comes from the key, never from the token
+	if header.Algorithm != k.algorithm {
+		return nil, ErrInvalidToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	if err := k.verify([]byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, err
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	claims := &TokenClaims{}
+	if err := json.Unmarshal(payload, claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	if claims.ExpiresAt == 0 || time.Now().Unix() >= claims.ExpiresAt {
+		return nil, ErrTokenExpired
+	}
+
+	return claims, nil
+}
+
+func (k *TokenKey) sign(data []byte) []byte {
+	if k.algorithm == tokenAlgorithmEdDSA {
+		return ed25519.Sign(k.privateKey, data)
+	}
+
+	mac := hmac.New(sha256.New, k.secret)
+	mac.Write(data)
+
+	return mac.Sum(nil)
+}
+
+func (k *TokenKey) verify(data, signature []byte) error {
+	if k.algorithm == tokenAlgorithmEdDSA {
+		if len(signature) != ed25519.SignatureSize || !ed25519.Verify(k.publicKey, data, signature) {
+			return ErrInvalidToken
+		}
+
+		return nil
+	}
+
+	if !hmac.Equal(k.sign(data), signature) {
+		return ErrInvalidToken
+	}
+
+	return nil
+}
@@ -0,0 +1,42 @@
+package meetup
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenPermissions(t *testing.T) {
+	key := NewHMACTokenKey([]byte("secret"))
+
+	token, err := key.Mint(NewTokenClaims("room", "alice", "Alice", time.Minute, Permissions{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := key.Verify(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if claims.Permissions == nil || *claims.Permissions != (Permissions{}) {
+		t.Errorf("permissions = %v, want empty permissions that replace the preset", claims.Permissions)
+	}
+
+	withoutPermissions := NewTokenClaims("room", "alice", "Alice", time.Minute, Permissions{})
+	withoutPermissions.Permissions = nil
+	withoutPermissions.Role = RoleViewer
+
+	token, err = key.Mint(withoutPermissions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err = key.Verify(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if claims.Permissions != nil {
+		t.Errorf("permissions = %v, want nil so the role preset applies", *claims.Permissions)
+	}
+}
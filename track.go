@@ -3,7 +3,11 @@ package meetup
 import (
 	"context"
 	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/gautam24s/meetup/pkg/interceptors/voiceactivedetector"
 	"github.com/pion/interceptor"
 	"github.com/pion/rtp"
 	"github.com/pion/webrtc/v4"
@@ -15,8 +19,21 @@ const (
 )
 
 var (
-	ErrTrackExists = errors.New("client: error track already exists")
+	ErrTrackExists      = errors.New("client: error track already exists")
 	ErrTrackIsNotExists = errors.New("client: error track is not exists")
+	ErrNotVideoTrack    = errors.New("client: error track is not a video track")
+	ErrTrackHardMuted   = errors.New("client: error track is muted by a moderator")
+)
+
+const (
+	muteReasonModerator = uint32(1 << iota)
+	muteReasonModeratorHard
+	muteReasonPublisher
+	// the publisher stopped sending media without telling us, it only pauses the
+	// subscribers and isn't reported as muted
+	muteReasonInactive
+
+	muteReasonsVisible = muteReasonModerator | muteReasonModeratorHard | muteReasonPublisher
 )
 
 type TrackType string
@@ -29,9 +46,9 @@ type ITrack interface {
 	ID() string
 	StreamID() string
 	ClientID() string
-	IsSimulcast() string
-	IsScaleable() string
-	IsProcessed() string
+	IsSimulcast() bool
+	IsScaleable() bool
+	IsProcessed() bool
 	SetSourceType(TrackType)
 	SourceType() TrackType
 	SetAsProcessed()
@@ -44,5 +61,524 @@ type ITrack interface {
 	Context() context.Context
 	Relay(func(webrtc.SSRC, interceptor.Attributes, *rtp.Packet))
 	PayloadType() webrtc.PayloadType
+	Codec() webrtc.RTPCodecParameters
+	SendPLI()
+	ReceiveBitrate() uint32
+	ClientTracks() []iClientTrack
+	IsMuted() bool
+	IsHardMuted() bool
 	OnEnded(func())
+	isPaused() bool
+	addClientTrack(iClientTrack)
+	removeClientTrack(clientID string)
+}
+
+type TrackInfo struct {
+	ClientID   string `json:"client_id"`
+	TrackID    string `json:"track_id"`
+	StreamID   string `json:"stream_id"`
+	Kind       string `json:"kind"`
+	MimeType   string `json:"mime_type"`
+	SourceType string `json:"source_type"`
+	Simulcast  bool   `json:"simulcast"`
+	Muted      bool   `json:"muted"`
+}
+
+func NewTrackInfo(track ITrack) TrackInfo {
+	return TrackInfo{
+		ClientID:   track.ClientID(),
+		TrackID:    track.ID(),
+		StreamID:   track.StreamID(),
+		Kind:       track.Kind().String(),
+		MimeType:   track.MimeType(),
+		SourceType: track.SourceType().String(),
+		Simulcast:  track.IsSimulcast(),
+		Muted:      track.IsMuted(),
+	}
+}
+
+func ridToQuality(rid string) QualityLevel {
+	switch rid {
+	case "high", "f":
+		return QualityHigh
+	case "mid", "h":
+		return QualityMid
+	case "low", "q":
+		return QualityLow
+	default:
+		return QualityHigh
+	}
+}
+
+type Track struct {
+	id               string
+	streamID         string
+	client           *Client
+	context          context.Context
+	cancel           context.CancelFunc
+	mu               sync.RWMutex
+	kind             webrtc.RTPCodecType
+	codec            webrtc.RTPCodecParameters
+	isSimulcast      bool
+	isProcessed      bool
+	sourceType       *atomic.Value
+	remoteTracks     map[string]*remoteTrack
+	clientTracks     *clientTrackList
+	dynacast         *dynacast
+	muteReasons      uint32
+	lastMediaAt      *atomic.Int64
+	onReadCallbacks  []func(interceptor.Attributes, *rtp.Packet, QualityLevel)
+	onRelayCallbacks []func(webrtc.SSRC, interceptor.Attributes, *rtp.Packet)
+	onEndedCallbacks []func()
+}
+
+func newTrack(client *Client, track IRemoteTrack) *Track {
+	localCtx, cancel := context.WithCancel(client.Context())
+
+	var sourceType atomic.Value
+	sourceType.Store(TrackType(TrackTypeMedia))
+
+	t := &Track{
+		id:               track.ID(),
+		streamID:         track.StreamID(),
+		client:           client,
+		context:          localCtx,
+		cancel:           cancel,
+		mu:               sync.RWMutex{},
+		kind:             track.Kind(),
+		codec:            track.Codec(),
+		isSimulcast:      track.RID() != "",
+		sourceType:       &sourceType,
+		remoteTracks:     make(map[string]*remoteTrack),
+		clientTracks:     newClientTrackList(),
+		lastMediaAt:      &atomic.Int64{},
+		onReadCallbacks:  make([]func(interceptor.Attributes, *rtp.Packet, QualityLevel), 0),
+		onRelayCallbacks: make([]func(webrtc.SSRC, interceptor.Attributes, *rtp.Packet), 0),
+		onEndedCallbacks: make([]func(), 0),
+	}
+
+	t.lastMediaAt.Store(time.Now().UnixNano())
+
+	t.addRemoteTrack(track)
+
+	if client.options.MuteDetectionTimeout > 0 {
+		go t.loopMuteDetection(client.options.MuteDetectionTimeout)
+	}
+
+	if t.isSimulcast && t.kind == webrtc.RTPCodecTypeVideo && client.options.EnableDynacast {
+		t.dynacast = newDynacast(t, client.options.DynacastDebounce)
+		go t.dynacast.loop()
+	}
+
+	return t
+}
+
+func (t *Track) addRemoteTrack(track IRemoteTrack) *remoteTrack {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if rt, ok := t.remoteTracks[track.RID()]; ok {
+		return rt
+	}
+
+	quality := t.qualityForRID(track.RID())
+	ssrc := track.SSRC()
+	client := t.client
+
+	pliInterval := client.sfu.pliInterval
+	if t.kind == webrtc.RTPCodecTypeAudio {
+		pliInterval = 0
+	}
+
+	rt := newRemoteTrack(
+		t.context,
+		client.log,
+		client.options.ReorderPackets,
+		track,
+		client.options.JitterBufferMinWait,
+		client.options.JitterBufferMaxWait,
+		pliInterval,
+		func() {
+			client.sendPLI(ssrc)
+		},
+		client.statsGetter,
+		nil,
+		func(attrs interceptor.Attributes, p *rtp.Packet) {
+			t.onRead(ssrc, attrs, p, quality)
+		},
+		client.sfu.rtppool,
+		nil,
+	)
+
+	rt.OnEnded(func() {
+		t.onRemoteTrackEnded(track.RID())
+	})
+
+	t.remoteTracks[track.RID()] = rt
+
+	return rt
+}
+
+func (t *Track) qualityForRID(rid string) QualityLevel {
+	if t.kind == webrtc.RTPCodecTypeAudio {
+		if t.codec.MimeType == "audio/red" {
+			return QualityAudioRed
+		}
+
+		return QualityAudio
+	}
+
+	return ridToQuality(rid)
+}
+
+func (t *Track) onRemoteTrackEnded(rid string) {
+	t.mu.Lock()
+	delete(t.remoteTracks, rid)
+	ended := len(t.remoteTracks) == 0
+	t.mu.Unlock()
+
+	if !ended {
+		return
+	}
+
+	t.cancel()
+
+	if t.kind == webrtc.RTPCodecTypeAudio {
+		t.client.sfu.audioTopN.removeTrack(t.id)
+	}
+
+	t.mu.RLock()
+	callbacks := t.onEndedCallbacks
+	t.mu.RUnlock()
+
+	for _, callback := range callbacks {
+		callback()
+	}
+}
+
+func (t *Track) onRead(ssrc webrtc.SSRC, attrs interceptor.Attributes, p *rtp.Packet, quality QualityLevel) {
+	t.mu.RLock()
+	readCallbacks := t.onReadCallbacks
+	relayCallbacks := t.onRelayCallbacks
+	inactive := t.muteReasons&muteReasonInactive != 0
+	t.mu.RUnlock()
+
+	// DTX frames are what a muted microphone sends, they don't count as media
+	if t.kind != webrtc.RTPCodecTypeAudio || !voiceactivedetector.IsDTX(t.codec.MimeType, p.Payload) {
+		t.lastMediaAt.Store(time.Now().UnixNano())
+
+		if inactive {
+			t.updateMute(0, muteReasonInactive)
+		}
+	}
+
+	if t.kind == webrtc.RTPCodecTypeAudio && !t.client.sfu.audioTopN.forward(t.id, attrs) {
+		t.clientTracks.skip()
+	} else {
+		t.clientTracks.push(p, quality)
+	}
+
+	for _, callback := range readCallbacks {
+		callback(attrs, p, quality)
+	}
+
+	for _, callback := range relayCallbacks {
+		callback(ssrc, attrs, p)
+	}
+}
+
+func (t *Track) RemoteTracks() map[string]*remoteTrack {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	remoteTracks := make(map[string]*remoteTrack, len(t.remoteTracks))
+	for rid, rt := range t.remoteTracks {
+		remoteTracks[rid] = rt
+	}
+
+	return remoteTracks
+}
+
+func (t *Track) ID() string {
+	return t.id
+}
+
+func (t *Track) StreamID() string {
+	return t.streamID
+}
+
+func (t *Track) ClientID() string {
+	return t.client.ID()
+}
+
+func (t *Track) Client() *Client {
+	return t.client
+}
+
+func (t *Track) IsSimulcast() bool {
+	return t.isSimulcast
+}
+
+func (t *Track) IsScaleable() bool {
+	return t.codec.MimeType == webrtc.MimeTypeVP9
+}
+
+func (t *Track) IsProcessed() bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return t.isProcessed
+}
+
+func (t *Track) SetAsProcessed() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.isProcessed = true
+}
+
+func (t *Track) SetSourceType(sourceType TrackType) {
+	t.sourceType.Store(sourceType)
+}
+
+func (t *Track) SourceType() TrackType {
+	return t.sourceType.Load().(TrackType)
+}
+
+func (t *Track) IsScreen() bool {
+	return t.SourceType() == TrackTypeScreen
+}
+
+func (t *Track) IsRelay() bool {
+	return false
+}
+
+func (t *Track) Kind() webrtc.RTPCodecType {
+	return t.kind
+}
+
+func (t *Track) MimeType() string {
+	return t.codec.MimeType
+}
+
+func (t *Track) Codec() webrtc.RTPCodecParameters {
+	return t.codec
+}
+
+func (t *Track) PayloadType() webrtc.PayloadType {
+	return t.codec.PayloadType
+}
+
+func (t *Track) TotalTracks() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return len(t.remoteTracks)
+}
+
+func (t *Track) Context() context.Context {
+	return t.context
+}
+
+func (t *Track) OnRead(callback func(interceptor.Attributes, *rtp.Packet, QualityLevel)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.onReadCallbacks = append(t.onReadCallbacks, callback)
+}
+
+func (t *Track) Relay(callback func(webrtc.SSRC, interceptor.Attributes, *rtp.Packet)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.onRelayCallbacks = append(t.onRelayCallbacks, callback)
+}
+
+func (t *Track) OnEnded(callback func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.onEndedCallbacks = append(t.onEndedCallbacks, callback)
+}
+
+func (t *Track) SendPLI() {
+	for _, rt := range t.RemoteTracks() {
+		rt.SendPLI()
+	}
+}
+
+func (t *Track) IsLayerEnabled(rid string) bool {
+	if t.dynacast == nil {
+		return true
+	}
+
+	return t.dynacast.IsLayerEnabled(rid)
+}
+
+func (t *Track) IsMuted() bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return t.muteReasons&muteReasonsVisible != 0
+}
+
+// isPaused tells if the track isn't forwarded, because it is muted or inactive.
+func (t *Track) isPaused() bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return t.muteReasons != 0
+}
+
+func (t *Track) IsHardMuted() bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return t.muteReasons&muteReasonModeratorHard != 0
+}
+
+// updateMute sets and clears mute reasons and pauses or resumes every subscriber
+// when the track goes from forwarding to paused or back. Only the mutes of the
+// publisher and the moderators are reported, an inactive track is just paused.
+func (t *Track) updateMute(set, clear uint32) {
+	t.mu.Lock()
+	wasPaused := t.muteReasons != 0
+	wasMuted := t.muteReasons&muteReasonsVisible != 0
+	t.muteReasons = (t.muteReasons | set) &^ clear
+	paused := t.muteReasons != 0
+	muted := t.muteReasons&muteReasonsVisible != 0
+	t.mu.Unlock()
+
+	if wasPaused != paused {
+		for _, ct := range t.ClientTracks() {
+			if paused {
+				ct.Client().pauseClientTrack(ct, pauseReasonMuted)
+			} else {
+				ct.Client().resumeClientTrack(ct, pauseReasonMuted)
+			}
+		}
+	}
+
+	if wasMuted != muted {
+		t.client.sfu.onTrackMuteChanged(t)
+	}
+}
+
+// loopMuteDetection pauses the track when the publisher sends no media for the
+// timeout, either no packets at all or only DTX frames for audio. The pause is
+// lifted on the next media packet.
+func (t *Track) loopMuteDetection(timeout time.Duration) {
+	ctx, cancel := context.WithCancel(t.context)
+	defer cancel()
+
+	ticker := time.NewTicker(timeout / 4)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if time.Since(time.Unix(0, t.lastMediaAt.Load())) < timeout {
+				continue
+			}
+
+			t.mu.RLock()
+			inactive := t.muteReasons&muteReasonInactive != 0
+			t.mu.RUnlock()
+
+			if !inactive {
+				t.updateMute(muteReasonInactive, 0)
+			}
+		}
+	}
+}
+
+// stop ends the track without waiting for the publisher to stop sending.
+func (t *Track) stop() {
+	t.cancel()
+}
+
+func (t *Track) ReceiveBitrate() uint32 {
+	bitrate := uint32(0)
+	for _, rt := range t.RemoteTracks() {
+		bitrate += rt.ReceiveBitrate()
+	}
+
+	return bitrate
+}
+
+func (t *Track) ClientTracks() []iClientTrack {
+	return t.clientTracks.GetTracks()
+}
+
+func (t *Track) addClientTrack(ct iClientTrack) {
+	t.clientTracks.Add(ct.Client().ID(), ct)
+}
+
+func (t *Track) removeClientTrack(clientID string) {
+	t.clientTracks.Remove(clientID)
+}
+
+type trackList struct {
+	tracks map[string]ITrack
+	mu     sync.RWMutex
+}
+
+func newTrackList() *trackList {
+	return &trackList{
+		tracks: make(map[string]ITrack),
+		mu:     sync.RWMutex{},
+	}
+}
+
+func (l *trackList) Add(track ITrack) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.tracks[track.ID()]; ok {
+		return ErrTrackExists
+	}
+
+	l.tracks[track.ID()] = track
+
+	return nil
+}
+
+func (l *trackList) Get(id string) (ITrack, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	track, ok := l.tracks[id]
+	if !ok {
+		return nil, ErrTrackIsNotExists
+	}
+
+	return track, nil
+}
+
+func (l *trackList) Remove(id string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.tracks, id)
+}
+
+func (l *trackList) GetTracks() []ITrack {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	tracks := make([]ITrack, 0, len(l.tracks))
+	for _, track := range l.tracks {
+		tracks = append(tracks, track)
+	}
+
+	return tracks
+}
+
+func (l *trackList) Length() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return len(l.tracks)
 }
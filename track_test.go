@@ -0,0 +1,57 @@
+package meetup
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestTrackInactiveIsNotMuted(t *testing.T) {
+	sfu := &SFU{clients: &SFUClients{clients: make(map[string]*Client), mu: sync.Mutex{}}}
+
+	changes := 0
+	sfu.OnTrackMuteChanged(func(ITrack) {
+		changes++
+	})
+
+	track := &Track{
+		id:           "track",
+		client:       &Client{sfu: sfu},
+		clientTracks: newClientTrackList(),
+	}
+
+	track.updateMute(muteReasonInactive, 0)
+
+	if !track.isPaused() {
+		t.Error("an inactive track should be paused")
+	}
+
+	if track.IsMuted() {
+		t.Error("an inactive track shouldn't be reported as muted")
+	}
+
+	if changes != 0 {
+		t.Errorf("mute changed %d times for an inactive track, want 0", changes)
+	}
+
+	track.updateMute(muteReasonPublisher, 0)
+
+	if !track.IsMuted() || changes != 1 {
+		t.Errorf("muted = %v with %d changes after the publisher muted, want true with 1", track.IsMuted(), changes)
+	}
+
+	track.updateMute(0, muteReasonPublisher)
+
+	if track.IsMuted() || changes != 2 {
+		t.Errorf("muted = %v with %d changes after the publisher unmuted, want false with 2", track.IsMuted(), changes)
+	}
+
+	if !track.isPaused() {
+		t.Error("the track should stay paused while inactive")
+	}
+
+	track.updateMute(0, muteReasonInactive)
+
+	if track.isPaused() || changes != 2 {
+		t.Errorf("paused = %v with %d changes once active, want false with 2", track.isPaused(), changes)
+	}
+}
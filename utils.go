@@ -2,6 +2,7 @@ package meetup
 
 import (
 	"errors"
+	"strings"
 
 	"github.com/jaevor/go-nanoid"
 	"github.com/pion/sdp/v3"
@@ -61,3 +62,101 @@ func RegisterSimulcastHeaderExtensions(m *webrtc.MediaEngine, codecType webrtc.R
 		}
 	}
 }
+
+func IsKeyframe(mimeType string, payload []byte) bool {
+	if len(payload) == 0 {
+		return false
+	}
+
+	switch strings.ToLower(mimeType) {
+	case strings.ToLower(webrtc.MimeTypeVP8):
+		return isVP8Keyframe(payload)
+	case strings.ToLower(webrtc.MimeTypeVP9):
+		return isVP9Keyframe(payload)
+	case strings.ToLower(webrtc.MimeTypeH264):
+		return isH264Keyframe(payload)
+	default:
+		return true
+	}
+}
+
+func isVP8Keyframe(payload []byte) bool {
+	idx := 1
+	start := payload[0]&0x10 != 0
+	partitionID := payload[0] & 0x07
+
+	if payload[0]&0x80 != 0 {
+		if len(payload) < 2 {
+			return false
+		}
+
+		ext := payload[1]
+		idx++
+
+		if ext&0x80 != 0 {
+			if len(payload) <= idx {
+				return false
+			}
+
+			if payload[idx]&0x80 != 0 {
+				idx++
+			}
+
+			idx++
+		}
+
+		if ext&0x40 != 0 {
+			idx++
+		}
+
+		if ext&0x30 != 0 {
+			idx++
+		}
+	}
+
+	if len(payload) <= idx || !start || partitionID != 0 {
+		return false
+	}
+
+	return payload[idx]&0x01 == 0
+}
+
+func isVP9Keyframe(payload []byte) bool {
+	interPicture := payload[0]&0x40 != 0
+	beginning := payload[0]&0x08 != 0
+
+	return !interPicture && beginning
+}
+
+func isH264Keyframe(payload []byte) bool {
+	nalType := payload[0] & 0x1F
+
+	switch nalType {
+	case 5, 7:
+		return true
+	case 24:
+		idx := 1
+		for idx+2 < len(payload) {
+			size := int(payload[idx])<<8 | int(payload[idx+1])
+			idx += 2
+
+			if idx >= len(payload) {
+				return false
+			}
+
+			if t := payload[idx] & 0x1F; t == 5 || t == 7 {
+				return true
+			}
+
+			idx += size
+		}
+	case 28:
+		if len(payload) < 2 {
+			return false
+		}
+
+		return payload[1]&0x80 != 0 && payload[1]&0x1F == 5
+	}
+
+	return false
+}
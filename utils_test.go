@@ -0,0 +1,65 @@
+package meetup
+
+import (
+	"testing"
+
+	"github.com/pion/webrtc/v4"
+)
+
+func TestIsKeyframe(t *testing.T) {
+	testCases := []struct {
+		name     string
+		mimeType string
+		payload  []byte
+		want     bool
+	}{
+		{"empty payload", webrtc.MimeTypeVP8, []byte{}, false},
+
+		// VP8 payload descriptor (RFC 7741) followed by the first byte of the frame
+		// header, whose lowest bit is 0 for a keyframe
+		{"vp8 keyframe", webrtc.MimeTypeVP8, []byte{0x10, 0x00}, true},
+		{"vp8 interframe", webrtc.MimeTypeVP8, []byte{0x10, 0x01}, false},
+		{"vp8 not the start of a partition", webrtc.MimeTypeVP8, []byte{0x00, 0x00}, false},
+		{"vp8 not the first partition", webrtc.MimeTypeVP8, []byte{0x11, 0x00}, false},
+		{"vp8 keyframe with 7 bit picture id", webrtc.MimeTypeVP8, []byte{0x90, 0x80, 0x05, 0x00}, true},
+		{"vp8 keyframe with 15 bit picture id", webrtc.MimeTypeVP8, []byte{0x90, 0x80, 0x85, 0x01, 0x00}, true},
+		{"vp8 keyframe with every extension", webrtc.MimeTypeVP8, []byte{0x90, 0xF0, 0x85, 0x01, 0x02, 0x03, 0x00}, true},
+		{"vp8 interframe with every extension", webrtc.MimeTypeVP8, []byte{0x90, 0xF0, 0x85, 0x01, 0x02, 0x03, 0x01}, false},
+		{"vp8 truncated extension byte", webrtc.MimeTypeVP8, []byte{0x90}, false},
+		{"vp8 truncated picture id", webrtc.MimeTypeVP8, []byte{0x90, 0x80}, false},
+		{"vp8 truncated 15 bit picture id", webrtc.MimeTypeVP8, []byte{0x90, 0x80, 0x85}, false},
+		{"vp8 truncated before the frame header", webrtc.MimeTypeVP8, []byte{0x90, 0xF0, 0x85, 0x01, 0x02, 0x03}, false},
+
+		// VP9 payload descriptor: P is 0x40 and B is 0x08
+		{"vp9 keyframe", webrtc.MimeTypeVP9, []byte{0x08}, true},
+		{"vp9 keyframe with picture id", webrtc.MimeTypeVP9, []byte{0x88, 0x01}, true},
+		{"vp9 interframe", webrtc.MimeTypeVP9, []byte{0x48}, false},
+		{"vp9 keyframe continuation", webrtc.MimeTypeVP9, []byte{0x00}, false},
+
+		// H264 NAL unit types (RFC 6184)
+		{"h264 idr", webrtc.MimeTypeH264, []byte{0x65, 0x88}, true},
+		{"h264 sps", webrtc.MimeTypeH264, []byte{0x67, 0x42}, true},
+		{"h264 non idr slice", webrtc.MimeTypeH264, []byte{0x41, 0x9A}, false},
+		{"h264 stap-a with sps", webrtc.MimeTypeH264, []byte{0x78, 0x00, 0x02, 0x67, 0x42, 0x00, 0x02, 0x68, 0xCE}, true},
+		{"h264 stap-a with idr after pps", webrtc.MimeTypeH264, []byte{0x78, 0x00, 0x02, 0x68, 0xCE, 0x00, 0x02, 0x65, 0x88}, true},
+		{"h264 stap-a without keyframe", webrtc.MimeTypeH264, []byte{0x78, 0x00, 0x02, 0x41, 0x9A, 0x00, 0x02, 0x41, 0x9B}, false},
+		{"h264 stap-a truncated size", webrtc.MimeTypeH264, []byte{0x78, 0x00}, false},
+		{"h264 stap-a truncated nal", webrtc.MimeTypeH264, []byte{0x78, 0x00, 0x02}, false},
+		{"h264 stap-a size overruns the payload", webrtc.MimeTypeH264, []byte{0x78, 0x00, 0x09, 0x41, 0x9A}, false},
+		{"h264 fu-a start of idr", webrtc.MimeTypeH264, []byte{0x7C, 0x85, 0x88}, true},
+		{"h264 fu-a middle of idr", webrtc.MimeTypeH264, []byte{0x7C, 0x05, 0x88}, false},
+		{"h264 fu-a start of non idr slice", webrtc.MimeTypeH264, []byte{0x7C, 0x81, 0x9A}, false},
+		{"h264 fu-a truncated header", webrtc.MimeTypeH264, []byte{0x7C}, false},
+
+		{"audio is always a keyframe", webrtc.MimeTypeOpus, []byte{0x01}, true},
+		{"mime type is case insensitive", "VIDEO/vp8", []byte{0x10, 0x00}, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := IsKeyframe(tc.mimeType, tc.payload); got != tc.want {
+				t.Errorf("IsKeyframe(%s, %x) = %v, want %v", tc.mimeType, tc.payload, got, tc.want)
+			}
+		})
+	}
+}